@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const redacted = "[REDACTED]"
+
+// accessLogOutput is where access logs are written to, one line per request.
+var accessLogOutput io.Writer = os.Stdout
+
+type accessLogEntry struct {
+	Time      time.Time         `json:"time"`
+	RequestID string            `json:"request_id"`
+	RemoteIP  string            `json:"remote_ip"`
+	User      string            `json:"user,omitempty"`
+	Method    string            `json:"method"`
+	Host      string            `json:"host"`
+	URI       string            `json:"uri"`
+	Route     string            `json:"route"`
+	Protocol  string            `json:"protocol"`
+	Status    int               `json:"status"`
+	Latency   float64           `json:"latency_ms"`
+	BytesIn   int64             `json:"bytes_in"`
+	BytesOut  int64             `json:"bytes_out"`
+	Referer   string            `json:"referer,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Headers   map[string]string `json:"headers"`
+}
+
+type accessLogger struct {
+	mu      sync.Mutex
+	out     io.Writer
+	format  string
+	headers map[string]bool
+	query   map[string]bool
+}
+
+func newAccessLogger(cfg logConfig, out io.Writer) *accessLogger {
+	l := &accessLogger{
+		out:     out,
+		format:  strings.ToLower(cfg.AccessFormat),
+		headers: map[string]bool{},
+		query:   map[string]bool{},
+	}
+	for _, h := range cfg.RedactHeaders {
+		l.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, q := range cfg.RedactQuery {
+		l.query[q] = true
+	}
+	return l
+}
+
+func (l *accessLogger) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		start := time.Now()
+		if err = next(c); err != nil {
+			c.Error(err)
+		}
+		entry := l.entry(c, start)
+		var line []byte
+		switch l.format {
+		case "json":
+			line, _ = json.Marshal(entry)
+		case "combined":
+			line = []byte(commonLogLine(entry) + fmt.Sprintf(" %q %q", orDash(entry.Referer), orDash(entry.UserAgent)))
+		default:
+			line = []byte(commonLogLine(entry))
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.out.Write(append(line, '\n'))
+		return
+	}
+}
+
+func (l *accessLogger) entry(c echo.Context, start time.Time) *accessLogEntry {
+	req, res := c.Request(), c.Response()
+	user, _, _ := req.BasicAuth()
+	if l.headers[echo.HeaderAuthorization] && user != "" {
+		user = redacted
+	}
+	entry := &accessLogEntry{
+		Time:      start,
+		RequestID: res.Header().Get(echo.HeaderXRequestID),
+		RemoteIP:  getOrigin(c),
+		User:      user,
+		Method:    req.Method,
+		Host:      req.Host,
+		URI:       l.redactURI(c.Path(), req.URL),
+		Route:     c.Path(),
+		Protocol:  req.Proto,
+		Status:    res.Status,
+		Latency:   float64(time.Since(start).Microseconds()) / 1000,
+		BytesIn:   req.ContentLength,
+		BytesOut:  res.Size,
+		Headers:   map[string]string{},
+	}
+	for k, v := range req.Header {
+		value := strings.Join(v, ", ")
+		if l.headers[k] {
+			value = l.redactHeader(k, v)
+		}
+		entry.Headers[k] = value
+		switch k {
+		case "Referer":
+			entry.Referer = value
+		case "User-Agent":
+			entry.UserAgent = value
+		}
+	}
+	if entry.BytesIn < 0 {
+		entry.BytesIn = 0
+	}
+	return entry
+}
+
+// redactHeader keeps the auth scheme and cookie names, which are useful for
+// debugging, but hides the credentials.
+func (l *accessLogger) redactHeader(name string, values []string) string {
+	switch name {
+	case echo.HeaderAuthorization, "Proxy-Authorization":
+		if scheme := strings.SplitN(values[0], " ", 2); len(scheme) == 2 {
+			return scheme[0] + " " + redacted
+		}
+	case echo.HeaderCookie:
+		var cookies []string
+		for _, cookie := range (&http.Request{Header: http.Header{"Cookie": values}}).Cookies() {
+			cookies = append(cookies, cookie.Name+"="+redacted)
+		}
+		return strings.Join(cookies, "; ")
+	}
+	return redacted
+}
+
+// redactPath hides the passwords in the path of routes like
+// /basic-auth/:user/:passwd, which are as secret as Authorization headers.
+func (l *accessLogger) redactPath(route, path string) string {
+	if !l.headers[echo.HeaderAuthorization] || !strings.Contains(route, "/:passwd") {
+		return path
+	}
+	routeSegments, segments := strings.Split(route, "/"), strings.Split(path, "/")
+	if len(routeSegments) != len(segments) {
+		return path
+	}
+	for i, v := range routeSegments {
+		if v == ":passwd" {
+			segments[i] = url.PathEscape(redacted)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (l *accessLogger) redactURI(route string, u *url.URL) string {
+	path := l.redactPath(route, u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	if len(l.query) == 0 || u.RawQuery == "" {
+		if u.ForceQuery || u.RawQuery != "" {
+			return path + "?" + u.RawQuery
+		}
+		return path
+	}
+	var parts []string
+	for _, part := range strings.Split(u.RawQuery, "&") {
+		key := strings.SplitN(part, "=", 2)[0]
+		if name, err := url.QueryUnescape(key); err == nil && l.query[name] {
+			part = key + "=" + url.QueryEscape(redacted)
+		}
+		parts = append(parts, part)
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+// commonLogLine formats the entry in Common Log Format.
+// see also: https://httpd.apache.org/docs/2.4/logs.html#common
+func commonLogLine(entry *accessLogEntry) string {
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %d`,
+		entry.RemoteIP,
+		orDash(entry.User),
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method,
+		entry.URI,
+		entry.Protocol,
+		entry.Status,
+		entry.BytesOut,
+	)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAccessLogEcho(format string, out io.Writer) *echo.Echo {
+	defer func(c *config, w io.Writer) { conf, accessLogOutput = c, w }(conf, accessLogOutput)
+	conf = defaultConfig()
+	conf.Log.AccessFormat = format
+	conf.Log.RedactQuery = []string{"token"}
+	conf.Proxy.Trusted = []string{"192.0.2.1"}
+	accessLogOutput = out
+	return newEcho()
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	out := new(bytes.Buffer)
+	e := newAccessLogEcho("json", out)
+
+	req := httptest.NewRequest(http.MethodGet, "/bearer?token=secret&q=1", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+	req.Header.Set(echo.HeaderCookie, "session=secret; theme=dark")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+
+	var entry accessLogEntry
+	if assert.NoError(t, json.Unmarshal(out.Bytes(), &entry)) {
+		assert.Equal(t, res.Header().Get(echo.HeaderXRequestID), entry.RequestID)
+		assert.NotEmpty(t, entry.RequestID)
+		assert.Equal(t, "203.0.113.7", entry.RemoteIP)
+		assert.Equal(t, "/bearer", entry.Route)
+		assert.Equal(t, http.StatusOK, entry.Status)
+		assert.Equal(t, int64(res.Body.Len()), entry.BytesOut)
+		assert.Equal(t, "/bearer?token=%5BREDACTED%5D&q=1", entry.URI)
+		assert.Equal(t, "Bearer [REDACTED]", entry.Headers[echo.HeaderAuthorization])
+		assert.Equal(t, "session=[REDACTED]; theme=[REDACTED]", entry.Headers[echo.HeaderCookie])
+	}
+	assert.NotContains(t, out.String(), "secret")
+}
+
+func TestAccessLogCommon(t *testing.T) {
+	cases := []struct {
+		format   string
+		expected *regexp.Regexp
+	}{
+		{"common", regexp.MustCompile(`^192\.0\.2\.1 - \[REDACTED\] \[.+\] "GET /basic-auth/a/%5BREDACTED%5D HTTP/1\.1" 200 \d+\n$`)},
+		{"combined", regexp.MustCompile(`^192\.0\.2\.1 - \[REDACTED\] \[.+\] "GET /basic-auth/a/%5BREDACTED%5D HTTP/1\.1" 200 \d+ "-" "fake-agent"\n$`)},
+	}
+	for _, v := range cases {
+		out := new(bytes.Buffer)
+		e := newAccessLogEcho(v.format, out)
+		req := httptest.NewRequest(http.MethodGet, "/basic-auth/a/b", nil)
+		req.SetBasicAuth("a", "b")
+		req.Header.Set("User-Agent", "fake-agent")
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		assert.Regexp(t, v.expected, out.String())
+	}
+
+	// passwords in the path are redacted along with the Authorization header
+	out := new(bytes.Buffer)
+	e := newAccessLogEcho("json", out)
+	req := httptest.NewRequest(http.MethodGet, "/basic-auth/user/secret?q=1", nil)
+	req.SetBasicAuth("user", "secret")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	var entry accessLogEntry
+	if assert.NoError(t, json.Unmarshal(out.Bytes(), &entry)) {
+		assert.Equal(t, "/basic-auth/user/%5BREDACTED%5D?q=1", entry.URI)
+	}
+	assert.NotContains(t, out.String(), "secret")
+
+	// errors returned by handlers are logged with their final status code
+	out = new(bytes.Buffer)
+	e = newAccessLogEcho("common", out)
+	req = httptest.NewRequest(http.MethodGet, "/bytes/x", nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Contains(t, out.String(), `"GET /bytes/x HTTP/1.1" 400 `)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const headerXEchobinHit = "X-Echobin-Hit"
+
+// maxCacheTestKeyLength limits the memory used by the keys of /cache-test.
+const maxCacheTestKeyLength = 256
+
+type cacheControlParams struct {
+	// Either public or private, or empty to leave out
+	Visibility string `query:"visibility" enums:"public,private" default:"public"`
+	// max-age in seconds, left out if negative
+	MaxAge int `query:"max_age" default:"60"`
+	// s-maxage in seconds, left out if negative
+	SMaxAge int `query:"s_maxage" default:"-1"`
+	// stale-while-revalidate in seconds, left out if negative
+	StaleWhileRevalidate int `query:"stale_while_revalidate" default:"-1"`
+	// stale-if-error in seconds, left out if negative
+	StaleIfError   int  `query:"stale_if_error" default:"-1"`
+	NoCache        bool `query:"no_cache"`
+	NoStore        bool `query:"no_store"`
+	MustRevalidate bool `query:"must_revalidate"`
+	Immutable      bool `query:"immutable"`
+}
+
+// newCacheControlParams returns cacheControlParams with every directive left
+// out but max-age.
+func newCacheControlParams(maxAge int) *cacheControlParams {
+	return &cacheControlParams{
+		MaxAge:               maxAge,
+		SMaxAge:              -1,
+		StaleWhileRevalidate: -1,
+		StaleIfError:         -1,
+	}
+}
+
+// String formats the value of a Cache-Control header.
+func (p *cacheControlParams) String() string {
+	var directives []string
+	if p.Visibility != "" {
+		directives = append(directives, p.Visibility)
+	}
+	if p.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	if p.NoStore {
+		directives = append(directives, "no-store")
+	}
+	seconds := []struct {
+		name  string
+		value int
+	}{
+		{"max-age", p.MaxAge},
+		{"s-maxage", p.SMaxAge},
+		{"stale-while-revalidate", p.StaleWhileRevalidate},
+		{"stale-if-error", p.StaleIfError},
+	}
+	for _, v := range seconds {
+		if v.value >= 0 {
+			directives = append(directives, fmt.Sprintf("%s=%d", v.name, v.value))
+		}
+	}
+	if p.MustRevalidate {
+		directives = append(directives, "must-revalidate")
+	}
+	if p.Immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+type cacheTestParams struct {
+	// Value of the Vary header
+	Vary string `query:"vary"`
+	// Seconds from now of the Expires header, left out if negative
+	Expires int `query:"expires" default:"-1"`
+	// Value of the Age header in seconds, left out if negative
+	Age int `query:"age" default:"-1"`
+	// Status code from 500 to 599 to fail with, for testing stale-if-error
+	Error int `query:"error"`
+}
+
+// cacheTestStats are the requests of a /cache-test key which reached the
+// server.
+type cacheTestStats struct {
+	Key     string `json:"key"`
+	Version int    `json:"version"`
+	// All requests which reached the server
+	Hits int64 `json:"hits"`
+	// Hits which were answered with 304 Not Modified
+	NotModified int64 `json:"not_modified"`
+	// Hits which were answered with an error
+	Errors       int64      `json:"errors"`
+	LastModified time.Time  `json:"last_modified"`
+	FirstHit     *time.Time `json:"first_hit"`
+	LastHit      *time.Time `json:"last_hit"`
+}
+
+func (s *cacheTestStats) etag() string {
+	return fmt.Sprintf(`"v%d"`, s.Version)
+}
+
+// cacheTestStore keeps the stats of /cache-test keys. When there are too many
+// keys, the least recently used one is forgotten.
+type cacheTestStore struct {
+	mu      sync.Mutex
+	entries map[string]*cacheTestStats
+	used    map[string]time.Time
+}
+
+var cacheTests = &cacheTestStore{
+	entries: map[string]*cacheTestStats{},
+	used:    map[string]time.Time{},
+}
+
+// update calls f with the stats of key, which are created if needed, and
+// returns a copy of them.
+func (s *cacheTestStore) update(key string, f func(stats *cacheTestStats, now time.Time)) cacheTestStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	stats, ok := s.entries[key]
+	if !ok {
+		for len(s.entries) > 0 && len(s.entries) >= conf.Limits.MaxCacheTestKeys {
+			s.evict()
+		}
+		stats = &cacheTestStats{Key: key, Version: 1, LastModified: now.Truncate(time.Second)}
+		s.entries[key] = stats
+	}
+	s.used[key] = now
+	f(stats, now)
+	return *stats
+}
+
+// get returns the stats of key, without creating them.
+func (s *cacheTestStore) get(key string) cacheTestStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats, ok := s.entries[key]; ok {
+		return *stats
+	}
+	return cacheTestStats{Key: key, Version: 1}
+}
+
+func (s *cacheTestStore) delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	delete(s.used, key)
+}
+
+func (s *cacheTestStore) evict() {
+	oldest := ""
+	for k, t := range s.used {
+		if oldest == "" || t.Before(s.used[oldest]) {
+			oldest = k
+		}
+	}
+	delete(s.entries, oldest)
+	delete(s.used, oldest)
+}
+
+func cacheTestKey(c echo.Context) (string, error) {
+	key := c.Param("key")
+	if key == "" || len(key) > maxCacheTestKeyLength {
+		return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("key must be 1 to %d bytes long", maxCacheTestKeyLength))
+	}
+	return key, nil
+}
+
+// @Summary   Counts the requests reaching the server for a key, with configurable caching headers. The ETag and Last-Modified headers change with the version of the key.
+// @Tags      Response inspection
+// @Produce   json
+// @Param     key                     path    string  true   "Key whose hits are counted"
+// @Param     visibility              query   string  false  "Either public or private, or empty to leave out"          default(public)  Enums(public, private)
+// @Param     max_age                 query   int     false  "max-age in seconds, left out if negative"                 default(60)
+// @Param     s_maxage                query   int     false  "s-maxage in seconds, left out if negative"                default(-1)
+// @Param     stale_while_revalidate  query   int     false  "stale-while-revalidate in seconds, left out if negative"  default(-1)
+// @Param     stale_if_error          query   int     false  "stale-if-error in seconds, left out if negative"          default(-1)
+// @Param     no_cache                query   bool    false  "no_cache"
+// @Param     no_store                query   bool    false  "no_store"
+// @Param     must_revalidate         query   bool    false  "must_revalidate"
+// @Param     immutable               query   bool    false  "immutable"
+// @Param     vary                    query   string  false  "Value of the Vary header"
+// @Param     expires                 query   int     false  "Seconds from now of the Expires header, left out if negative"  default(-1)
+// @Param     age                     query   int     false  "Value of the Age header in seconds, left out if negative"      default(-1)
+// @Param     error                   query   int     false  "Status code from 500 to 599 to fail with, for testing stale-if-error"
+// @Param     If-None-Match           header  string  false  "If-None-Match"
+// @Param     If-Modified-Since       header  string  false  "If-Modified-Since"
+// @Response  200                     "The key and its version, the number of the hit is in the X-Echobin-Hit header."
+// @Response  304                     "Not modified"
+// @Response  500                     "The requested error"
+// @Router    /cache-test/{key} [get]
+// @Router    /cache-test/{key} [head]
+func cacheTestHandler(c echo.Context) error {
+	key, err := cacheTestKey(c)
+	if err != nil {
+		return err
+	}
+	cc := newCacheControlParams(60)
+	cc.Visibility = "public"
+	p := &cacheTestParams{Expires: -1, Age: -1}
+	for _, params := range []interface{}{cc, p} {
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+			return err
+		}
+	}
+	if cc.Visibility != "public" && cc.Visibility != "private" && cc.Visibility != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "visibility must be public or private")
+	}
+	if p.Error != 0 && (p.Error < 500 || p.Error > 599) {
+		return echo.NewHTTPError(http.StatusBadRequest, "error must be in the range [500, 599]")
+	}
+
+	status := 0
+	stats := cacheTests.update(key, func(stats *cacheTestStats, now time.Time) {
+		stats.Hits++
+		if stats.FirstHit == nil {
+			stats.FirstHit = &now
+		}
+		stats.LastHit = &now
+		if p.Error != 0 {
+			stats.Errors++
+			return
+		}
+		if status, _ = checkPreconditions(c.Request(), stats.etag(), stats.LastModified); status == http.StatusNotModified {
+			stats.NotModified++
+		}
+	})
+
+	h := c.Response().Header()
+	h.Set(headerXEchobinHit, strconv.FormatInt(stats.Hits, 10))
+	if p.Error != 0 {
+		h.Set("Cache-Control", "no-store")
+		return echo.NewHTTPError(p.Error, fmt.Sprintf("failing with %d as requested", p.Error))
+	}
+	if v := cc.String(); v != "" {
+		h.Set("Cache-Control", v)
+	}
+	if p.Vary != "" {
+		h.Add(echo.HeaderVary, p.Vary)
+	}
+	if p.Expires >= 0 {
+		h.Set("Expires", time.Now().UTC().Add(time.Duration(p.Expires)*time.Second).Format(http.TimeFormat))
+	}
+	if p.Age >= 0 {
+		h.Set("Age", strconv.Itoa(p.Age))
+	}
+	h.Set("ETag", stats.etag())
+	h.Set(echo.HeaderLastModified, stats.LastModified.Format(http.TimeFormat))
+	if status != 0 {
+		return c.NoContent(status)
+	}
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{
+		"key":           stats.Key,
+		"version":       stats.Version,
+		"last_modified": stats.LastModified,
+	}, "  ")
+}
+
+// @Summary  Returns the number of requests which reached the server for a key.
+// @Tags     Response inspection
+// @Produce  json
+// @Param    key  path      string  true  "Key whose hits are counted"
+// @Success  200  {object}  cacheTestStats
+// @Router   /cache-test/{key}/stats [get]
+func cacheTestStatsHandler(c echo.Context) error {
+	key, err := cacheTestKey(c)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Cache-Control", "no-store")
+	stats := cacheTests.get(key)
+	return c.JSONPretty(http.StatusOK, &stats, "  ")
+}
+
+// @Summary   Forgets the hits and version of a key.
+// @Tags      Response inspection
+// @Param     key  path  string  true  "Key whose hits are counted"
+// @Response  204  "The key was reset"
+// @Router    /cache-test/{key}/stats [delete]
+func cacheTestResetHandler(c echo.Context) error {
+	key, err := cacheTestKey(c)
+	if err != nil {
+		return err
+	}
+	cacheTests.delete(key)
+	return c.NoContent(http.StatusNoContent)
+}
+
+type cacheTestVersionParams struct {
+	// The new version, the current one plus one by default
+	Version int `query:"version"`
+}
+
+// @Summary  Changes the version of the content of a key, as if it was modified.
+// @Tags     Response inspection
+// @Produce  json
+// @Param    key                     path      string                  true   "Key whose hits are counted"
+// @Param    cacheTestVersionParams  query     cacheTestVersionParams  false  "cacheTestVersionParams"
+// @Success  200                     {object}  cacheTestStats
+// @Router   /cache-test/{key}/version [post]
+func cacheTestVersionHandler(c echo.Context) error {
+	key, err := cacheTestKey(c)
+	if err != nil {
+		return err
+	}
+	p := &cacheTestVersionParams{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if p.Version < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "version must not be negative")
+	}
+	stats := cacheTests.update(key, func(stats *cacheTestStats, now time.Time) {
+		if p.Version > 0 {
+			stats.Version = p.Version
+		} else {
+			stats.Version++
+		}
+		stats.LastModified = now.Truncate(time.Second)
+	})
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSONPretty(http.StatusOK, &stats, "  ")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheTestHandler(t *testing.T) {
+	e := newEcho()
+	do := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+	stats := func(key string) cacheTestStats {
+		s := cacheTestStats{}
+		assert.NoError(t, json.Unmarshal(do(http.MethodGet, "/cache-test/"+key+"/stats", nil).Body.Bytes(), &s))
+		return s
+	}
+	cacheTests.delete("a")
+	defer cacheTests.delete("a")
+
+	res := do(http.MethodGet, "/cache-test/a", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "public, max-age=60", res.Header().Get("Cache-Control"))
+	assert.Equal(t, `"v1"`, res.Header().Get("ETag"))
+	assert.Equal(t, "1", res.Header().Get("X-Echobin-Hit"))
+	assert.Empty(t, res.Header().Get("Expires"))
+	assert.Empty(t, res.Header().Get("Age"))
+	lastModified := res.Header().Get("Last-Modified")
+
+	res = do(http.MethodGet, "/cache-test/a?visibility=private&max_age=10&s_maxage=20&stale_while_revalidate=30&stale_if_error=40&must_revalidate=true&vary=Accept-Encoding&expires=0&age=5", nil)
+	assert.Equal(t, "private, max-age=10, s-maxage=20, stale-while-revalidate=30, stale-if-error=40, must-revalidate", res.Header().Get("Cache-Control"))
+	assert.Contains(t, res.Header().Values("Vary"), "Accept-Encoding")
+	expires, err := http.ParseTime(res.Header().Get("Expires"))
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now(), expires, 2*time.Second)
+	}
+	assert.Equal(t, "5", res.Header().Get("Age"))
+	assert.Equal(t, "2", res.Header().Get("X-Echobin-Hit"))
+	res = do(http.MethodGet, "/cache-test/a?visibility=&max_age=-1&no_store=true", nil)
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+	// revalidations
+	res = do(http.MethodGet, "/cache-test/a", map[string]string{"If-None-Match": `"v1"`})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, "public, max-age=60", res.Header().Get("Cache-Control"))
+	assert.Equal(t, `"v1"`, res.Header().Get("ETag"))
+	res = do(http.MethodHead, "/cache-test/a", map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+
+	// errors
+	res = do(http.MethodGet, "/cache-test/a?error=503", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+	s := stats("a")
+	assert.Equal(t, "a", s.Key)
+	assert.Equal(t, 1, s.Version)
+	assert.Equal(t, int64(6), s.Hits)
+	assert.Equal(t, int64(2), s.NotModified)
+	assert.Equal(t, int64(1), s.Errors)
+	assert.NotNil(t, s.FirstHit)
+	assert.Equal(t, int64(6), stats("a").Hits, "stats aren't hits")
+
+	// new versions
+	res = do(http.MethodPost, "/cache-test/a/version", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 2, stats("a").Version)
+	res = do(http.MethodGet, "/cache-test/a", map[string]string{"If-None-Match": `"v1"`})
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"v2"`, res.Header().Get("ETag"))
+	do(http.MethodPost, "/cache-test/a/version?version=10", nil)
+	assert.Equal(t, 10, stats("a").Version)
+
+	res = do(http.MethodDelete, "/cache-test/a/stats", nil)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	s = stats("a")
+	assert.Equal(t, int64(0), s.Hits)
+	assert.Nil(t, s.FirstHit)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/cache-test/a?visibility=secret", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/cache-test/a?error=404", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/cache-test/a/version?version=-1", nil).Code)
+}
+
+func TestCacheTestStore(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Limits.MaxCacheTestKeys = 2
+
+	s := &cacheTestStore{entries: map[string]*cacheTestStats{}, used: map[string]time.Time{}}
+	hit := func(stats *cacheTestStats, now time.Time) { stats.Hits++ }
+	s.update("a", hit)
+	s.update("b", hit)
+	s.update("a", hit)
+	s.update("c", hit)
+	assert.Len(t, s.entries, 2)
+	assert.Equal(t, int64(2), s.get("a").Hits)
+	assert.Equal(t, int64(0), s.get("b").Hits, "least recently used key is forgotten")
+	assert.Equal(t, int64(1), s.get("c").Hits)
+}
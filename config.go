@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/labstack/gommon/log"
+	"gopkg.in/yaml.v3"
+)
+
+// conf is the configuration used by newEcho and the handlers. main replaces
+// it with the one resolved from config file, environment and flags.
+var conf = defaultConfig()
+
+// config holds every runtime setting of echobin. Sources are applied in the
+// following order, each one overriding the previous:
+// built-in defaults, config file, ECHOBIN_* environment variables and flags.
+type config struct {
+	ListenAddr string         `yaml:"listen_addr" toml:"listen_addr"`
+	Limits     limitsConfig   `yaml:"limits" toml:"limits"`
+	Routes     routesConfig   `yaml:"routes" toml:"routes"`
+	CORS       corsConfig     `yaml:"cors" toml:"cors"`
+	Log        logConfig      `yaml:"log" toml:"log"`
+	Metrics    metricsConfig  `yaml:"metrics" toml:"metrics"`
+	Shutdown   shutdownConfig `yaml:"shutdown" toml:"shutdown"`
+	Proxy      proxyConfig    `yaml:"proxy" toml:"proxy"`
+	TLS        tlsConfig      `yaml:"tls" toml:"tls"`
+	Session    sessionConfig  `yaml:"session" toml:"session"`
+}
+
+type limitsConfig struct {
+	// Maximum number of bytes returned by /bytes, /stream-bytes and /range
+	MaxBytes int `yaml:"max_bytes" toml:"max_bytes"`
+	// Maximum delay (in seconds) of /delay and /drip
+	MaxDelay int `yaml:"max_delay" toml:"max_delay"`
+	// Maximum number of bytes returned by /drip
+	MaxDripBytes int `yaml:"max_drip_bytes" toml:"max_drip_bytes"`
+	// Maximum duration (in seconds) of /drip and /range
+	MaxDuration int `yaml:"max_duration" toml:"max_duration"`
+	// Maximum number of links generated by /links
+	MaxLinks int `yaml:"max_links" toml:"max_links"`
+	// Maximum number of JSON objects streamed by /stream
+	MaxStream int `yaml:"max_stream" toml:"max_stream"`
+	// Maximum number of documents generated by /random/json
+	MaxRandomCount int `yaml:"max_random_count" toml:"max_random_count"`
+	// Maximum size of documents generated by /generate, and of all documents
+	// of a /random/json response
+	MaxDocumentBytes int `yaml:"max_document_bytes" toml:"max_document_bytes"`
+	// Maximum number of pixels of images, all frames of animated GIFs included
+	MaxImagePixels int `yaml:"max_image_pixels" toml:"max_image_pixels"`
+	// Maximum size images can be padded to
+	MaxImageBytes int `yaml:"max_image_bytes" toml:"max_image_bytes"`
+	// Maximum decompressed size of /bomb responses
+	MaxBombBytes int `yaml:"max_bomb_bytes" toml:"max_bomb_bytes"`
+	// Maximum size of files served by /download
+	MaxDownloadBytes int64 `yaml:"max_download_bytes" toml:"max_download_bytes"`
+	// Maximum number of ranges of a Range header
+	MaxRanges int `yaml:"max_ranges" toml:"max_ranges"`
+	// Maximum number of keys /cache-test keeps hit counters for
+	MaxCacheTestKeys int `yaml:"max_cache_test_keys" toml:"max_cache_test_keys"`
+	// Maximum number of hops of /redirect-chain
+	MaxRedirectHops int `yaml:"max_redirect_hops" toml:"max_redirect_hops"`
+	// Maximum number of preflights /cors remembers
+	MaxCORSPreflights int `yaml:"max_cors_preflights" toml:"max_cors_preflights"`
+	// Maximum number of reports /csp-report keeps
+	MaxCSPReports int `yaml:"max_csp_reports" toml:"max_csp_reports"`
+}
+
+type routesConfig struct {
+	// Path prefix under which all routes are mounted, e.g. /echobin
+	BasePath string `yaml:"base_path" toml:"base_path"`
+	// Route groups to disable, named after the tags of the API docs
+	Disabled []string `yaml:"disabled" toml:"disabled"`
+}
+
+type corsConfig struct {
+	AllowOrigins     []string `yaml:"allow_origins" toml:"allow_origins"`
+	AllowMethods     []string `yaml:"allow_methods" toml:"allow_methods"`
+	AllowHeaders     []string `yaml:"allow_headers" toml:"allow_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials"`
+	ExposeHeaders    []string `yaml:"expose_headers" toml:"expose_headers"`
+	MaxAge           int      `yaml:"max_age" toml:"max_age"`
+}
+
+type logConfig struct {
+	// One of debug, info, warn, error and off
+	Level string `yaml:"level" toml:"level"`
+	// Whether to print the startup banner
+	Banner bool `yaml:"banner" toml:"banner"`
+	// Access log format, one of off, json, common and combined
+	AccessFormat string `yaml:"access_format" toml:"access_format"`
+	// Request headers whose values are hidden in access logs
+	RedactHeaders []string `yaml:"redact_headers" toml:"redact_headers"`
+	// Query parameters whose values are hidden in access logs
+	RedactQuery []string `yaml:"redact_query" toml:"redact_query"`
+}
+
+type metricsConfig struct {
+	// Whether to expose Prometheus metrics on /metrics
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+}
+
+type shutdownConfig struct {
+	// Time (in seconds) /readyz fails before new connections are refused
+	DrainDelay int `yaml:"drain_delay" toml:"drain_delay"`
+	// Time (in seconds) in-flight requests are given to complete
+	DrainTimeout int `yaml:"drain_timeout" toml:"drain_timeout"`
+	// Whether to abort streaming responses like /drip instead of finishing them
+	AbortStreams bool `yaml:"abort_streams" toml:"abort_streams"`
+}
+
+type proxyConfig struct {
+	// IPs and CIDRs of proxies whose Forwarded, X-Forwarded-For and
+	// X-Real-IP headers are trusted to resolve client IPs
+	Trusted []string `yaml:"trusted" toml:"trusted"`
+}
+
+type tlsConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+}
+
+type sessionConfig struct {
+	// Secret /session cookies are signed and encrypted with, random if empty
+	Secret string `yaml:"secret" toml:"secret"`
+}
+
+var routeGroups = []string{
+	"HTTP methods",
+	"Auth",
+	"Status codes",
+	"Request inspection",
+	"Response inspection",
+	"Response formats",
+	"Dynamic data",
+	"Cookies",
+	"Images",
+	"Redirects",
+	"Anything",
+}
+
+var logLevels = map[string]log.Lvl{
+	"debug": log.DEBUG,
+	"info":  log.INFO,
+	"warn":  log.WARN,
+	"error": log.ERROR,
+	"off":   log.OFF,
+}
+
+func defaultConfig() *config {
+	return &config{
+		ListenAddr: ":8080",
+		Limits: limitsConfig{
+			MaxBytes:          100 << 10,
+			MaxDelay:          10,
+			MaxDripBytes:      10 << 20,
+			MaxDuration:       60,
+			MaxLinks:          200,
+			MaxStream:         100,
+			MaxRandomCount:    1000,
+			MaxDocumentBytes:  1 << 20,
+			MaxImagePixels:    4 << 20,
+			MaxImageBytes:     16 << 20,
+			MaxBombBytes:      1 << 30,
+			MaxDownloadBytes:  4 << 30,
+			MaxRanges:         50,
+			MaxCacheTestKeys:  1000,
+			MaxRedirectHops:   100,
+			MaxCORSPreflights: 100,
+			MaxCSPReports:     100,
+		},
+		Routes: routesConfig{
+			Disabled: []string{},
+		},
+		CORS: corsConfig{
+			AllowOrigins:  []string{"*"},
+			AllowMethods:  []string{"GET", "HEAD", "PUT", "PATCH", "POST", "DELETE"},
+			AllowHeaders:  []string{},
+			ExposeHeaders: []string{},
+		},
+		Log: logConfig{
+			Level:         "error",
+			Banner:        true,
+			AccessFormat:  "off",
+			RedactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie"},
+			RedactQuery:   []string{},
+		},
+		Metrics: metricsConfig{
+			Enabled: true,
+		},
+		Shutdown: shutdownConfig{
+			DrainTimeout: 30,
+		},
+		Proxy: proxyConfig{
+			// loopback and private networks
+			Trusted: []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+		},
+	}
+}
+
+func (rc routesConfig) enabled(group string) bool {
+	for _, d := range rc.Disabled {
+		if strings.EqualFold(d, group) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cfg *config) validate() error {
+	nonNegatives := map[string]int{
+		"limits.max_bytes":           cfg.Limits.MaxBytes,
+		"limits.max_delay":           cfg.Limits.MaxDelay,
+		"limits.max_drip_bytes":      cfg.Limits.MaxDripBytes,
+		"limits.max_duration":        cfg.Limits.MaxDuration,
+		"limits.max_links":           cfg.Limits.MaxLinks,
+		"limits.max_stream":          cfg.Limits.MaxStream,
+		"limits.max_random_count":    cfg.Limits.MaxRandomCount,
+		"limits.max_document_bytes":  cfg.Limits.MaxDocumentBytes,
+		"limits.max_image_pixels":    cfg.Limits.MaxImagePixels,
+		"limits.max_image_bytes":     cfg.Limits.MaxImageBytes,
+		"limits.max_bomb_bytes":      cfg.Limits.MaxBombBytes,
+		"limits.max_ranges":          cfg.Limits.MaxRanges,
+		"limits.max_cache_test_keys": cfg.Limits.MaxCacheTestKeys,
+		"limits.max_redirect_hops":   cfg.Limits.MaxRedirectHops,
+		"limits.max_cors_preflights": cfg.Limits.MaxCORSPreflights,
+		"limits.max_csp_reports":     cfg.Limits.MaxCSPReports,
+		"shutdown.drain_delay":       cfg.Shutdown.DrainDelay,
+		"shutdown.drain_timeout":     cfg.Shutdown.DrainTimeout,
+	}
+	for k, v := range nonNegatives {
+		if v < 0 {
+			return fmt.Errorf("%s must not be negative", k)
+		}
+	}
+	if cfg.Limits.MaxDownloadBytes < 0 {
+		return errors.New("limits.max_download_bytes must not be negative")
+	}
+	if cfg.Routes.BasePath != "" && !strings.HasPrefix(cfg.Routes.BasePath, "/") {
+		return fmt.Errorf("routes.base_path %q must start with /", cfg.Routes.BasePath)
+	}
+	for _, d := range cfg.Routes.Disabled {
+		known := false
+		for _, g := range routeGroups {
+			if strings.EqualFold(d, g) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown route group %q in routes.disabled", d)
+		}
+	}
+	if _, ok := logLevels[strings.ToLower(cfg.Log.Level)]; !ok {
+		return fmt.Errorf("unknown log level %q", cfg.Log.Level)
+	}
+	switch strings.ToLower(cfg.Log.AccessFormat) {
+	case "off", "json", "common", "combined":
+	default:
+		return fmt.Errorf("unknown access log format %q", cfg.Log.AccessFormat)
+	}
+	if _, err := parseTrustedProxies(cfg.Proxy.Trusted); err != nil {
+		return err
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return errors.New("tls.cert_file and tls.key_file must be set together")
+	}
+	return nil
+}
+
+// configField is a leaf setting of config, addressed by its yaml key path.
+type configField struct {
+	path  []string
+	value reflect.Value
+}
+
+func (f configField) key() string {
+	return strings.Join(f.path, ".")
+}
+
+// flagName turns limits.max_bytes into limits.max-bytes
+func (f configField) flagName() string {
+	return strings.ReplaceAll(f.key(), "_", "-")
+}
+
+// envName turns limits.max_bytes into ECHOBIN_LIMITS_MAX_BYTES
+func (f configField) envName() string {
+	return "ECHOBIN_" + strings.ToUpper(strings.Join(f.path, "_"))
+}
+
+func configFields(v reflect.Value, prefix []string) []configField {
+	var fields []configField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		path := append(append([]string{}, prefix...), name)
+		if t.Field(i).Type.Kind() == reflect.Struct {
+			fields = append(fields, configFields(v.Field(i), path)...)
+		} else {
+			fields = append(fields, configField{path, v.Field(i)})
+		}
+	}
+	return fields
+}
+
+func (f configField) set(s string) error {
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(s)
+	case reflect.Int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", s, f.key(), err)
+		}
+		f.value.SetInt(int64(i))
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", s, f.key(), err)
+		}
+		f.value.SetFloat(x)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", s, f.key(), err)
+		}
+		f.value.SetBool(b)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type of %s", f.key())
+	}
+	return nil
+}
+
+func (f configField) String() string {
+	if f.value.Kind() == reflect.Slice {
+		return strings.Join(f.value.Interface().([]string), ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
+
+// rawFlag remembers the value of a flag so it can be applied after the
+// config file and environment variables.
+type rawFlag struct {
+	value string
+	set   bool
+}
+
+func (r *rawFlag) String() string { return r.value }
+
+func (r *rawFlag) Set(s string) error {
+	r.value, r.set = s, true
+	return nil
+}
+
+type boolRawFlag struct{ rawFlag }
+
+func (r *boolRawFlag) IsBoolFlag() bool { return true }
+
+func readConfigFile(path string, cfg *config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %q", path, undecoded[0].String())
+		}
+	default:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// loadConfig resolves the configuration from defaults, the config file given
+// by --config or ECHOBIN_CONFIG, environment variables and command line flags.
+func loadConfig(args []string, getenv func(string) string) (cfg *config, printConfig bool, err error) {
+	cfg = defaultConfig()
+	fields := configFields(reflect.ValueOf(cfg).Elem(), nil)
+
+	fs := flag.NewFlagSet("echobin", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("ECHOBIN_CONFIG"), "path to a YAML or TOML config file")
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective config as YAML and exit")
+	flags := make([]*rawFlag, len(fields))
+	for i, f := range fields {
+		usage := fmt.Sprintf("%s (env %s)", f.key(), f.envName())
+		if f.value.Kind() == reflect.Bool {
+			bf := &boolRawFlag{rawFlag{value: f.String()}}
+			fs.Var(bf, f.flagName(), usage)
+			flags[i] = &bf.rawFlag
+		} else {
+			flags[i] = &rawFlag{value: f.String()}
+			fs.Var(flags[i], f.flagName(), usage)
+		}
+	}
+	if err = fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	if *configFile != "" {
+		if err = readConfigFile(*configFile, cfg); err != nil {
+			return nil, false, err
+		}
+	}
+	// LISTEN_ADDR predates the config subsystem and is still honored
+	if v := getenv("LISTEN_ADDR"); v != "" {
+		cfg.ListenAddr = v
+	}
+	for _, f := range fields {
+		if v := getenv(f.envName()); v != "" {
+			if err = f.set(v); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	for i, f := range fields {
+		if flags[i].set {
+			if err = f.set(flags[i].value); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	cfg.Routes.BasePath = strings.TrimRight(cfg.Routes.BasePath, "/")
+	if err = cfg.validate(); err != nil {
+		return nil, false, err
+	}
+	return cfg, printConfig, nil
+}
+
+func writeConfig(w io.Writer, cfg *config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(cfg)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeEnv(env map[string]string) func(string) string {
+	return func(k string) string {
+		return env[k]
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, printConfig, err := loadConfig(nil, fakeEnv(nil))
+	if assert.NoError(t, err) {
+		assert.False(t, printConfig)
+		assert.Equal(t, defaultConfig(), cfg)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "echobin.yaml")
+	assert.NoError(t, os.WriteFile(yamlFile, []byte(`
+listen_addr: ":9000"
+limits:
+  max_bytes: 10
+  max_links: 20
+  max_stream: 30
+routes:
+  disabled: [Cookies]
+`), 0o644))
+
+	env := fakeEnv(map[string]string{
+		"ECHOBIN_CONFIG":           yamlFile,
+		"ECHOBIN_LIMITS_MAX_LINKS": "21",
+		"ECHOBIN_LIMITS_MAX_BYTES": "11",
+	})
+	cfg, _, err := loadConfig([]string{"--limits.max-bytes", "12", "--log.banner=false"}, env)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ":9000", cfg.ListenAddr)  // file
+		assert.Equal(t, 30, cfg.Limits.MaxStream) // file
+		assert.Equal(t, 21, cfg.Limits.MaxLinks)  // env over file
+		assert.Equal(t, 12, cfg.Limits.MaxBytes)  // flag over env
+		assert.Equal(t, 10, cfg.Limits.MaxDelay)  // default
+		assert.False(t, cfg.Log.Banner)           // flag
+		assert.Equal(t, []string{"Cookies"}, cfg.Routes.Disabled)
+	}
+
+	// LISTEN_ADDR is still honored
+	cfg, _, err = loadConfig(nil, fakeEnv(map[string]string{"LISTEN_ADDR": "0.0.0.0:8081"}))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0.0.0.0:8081", cfg.ListenAddr)
+	}
+}
+
+func TestLoadConfigTOML(t *testing.T) {
+	tomlFile := filepath.Join(t.TempDir(), "echobin.toml")
+	assert.NoError(t, os.WriteFile(tomlFile, []byte(`
+[cors]
+allow_origins = ["https://example.com"]
+allow_credentials = true
+`), 0o644))
+	cfg, _, err := loadConfig([]string{"--config", tomlFile, "--cors.allow-headers", "X-A, X-B"}, fakeEnv(nil))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"https://example.com"}, cfg.CORS.AllowOrigins)
+		assert.True(t, cfg.CORS.AllowCredentials)
+		assert.Equal(t, []string{"X-A", "X-B"}, cfg.CORS.AllowHeaders)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknownKey := filepath.Join(dir, "unknown.yaml")
+	assert.NoError(t, os.WriteFile(unknownKey, []byte("limits:\n  max_foo: 1\n"), 0o644))
+
+	cases := [][]string{
+		{"--limits.max-bytes", "abc"},
+		{"--limits.max-delay", "-1"},
+		{"--routes.disabled", "Unknown"},
+		{"--log.level", "verbose"},
+		{"--tls.cert-file", "cert.pem"},
+		{"--config", unknownKey},
+		{"--config", filepath.Join(dir, "missing.yaml")},
+	}
+	for _, args := range cases {
+		_, _, err := loadConfig(args, fakeEnv(nil))
+		assert.Error(t, err, args)
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	cfg, printConfig, err := loadConfig([]string{"--print-config", "--limits.max-stream", "5"}, fakeEnv(nil))
+	if assert.NoError(t, err) {
+		assert.True(t, printConfig)
+		buf := new(bytes.Buffer)
+		assert.NoError(t, writeConfig(buf, cfg))
+		assert.Contains(t, buf.String(), "max_stream: 5\n")
+
+		// the printed config can be loaded back
+		file := filepath.Join(t.TempDir(), "printed.yaml")
+		assert.NoError(t, os.WriteFile(file, buf.Bytes(), 0o644))
+		loaded, _, err := loadConfig([]string{"--config", file}, fakeEnv(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, cfg, loaded)
+	}
+}
+
+func TestDisabledRouteGroups(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Routes.Disabled = []string{"cookies"}
+	e := newEcho()
+
+	req := httptest.NewRequest(http.MethodGet, "/cookies", nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	// falls through to the Swagger UI catch-all route
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/get", nil)
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestDisabledRedirectTarget(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Routes.BasePath = "/echobin"
+	conf.Routes.Disabled = []string{"HTTP methods"}
+	e := newEcho()
+
+	// the last redirect can't go to /get
+	req := httptest.NewRequest(http.MethodGet, "/echobin/redirect/1", nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusFound, res.Code)
+	assert.Equal(t, "/echobin/", res.Header().Get("Location"))
+}
+
+func TestBasePath(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	cfg, _, err := loadConfig([]string{"--routes.base-path", "/echobin/"}, fakeEnv(nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "/echobin", cfg.Routes.BasePath)
+	conf = cfg
+	e := newEcho()
+
+	cases := []struct {
+		target   string
+		code     int
+		location string
+	}{
+		{"/get", http.StatusNotFound, ""},
+		{"/echobin/get", http.StatusOK, ""},
+		{"/echobin", http.StatusMovedPermanently, "/echobin/"},
+		{"/echobin/", http.StatusOK, ""},
+		{"/echobin/swagger.json", http.StatusOK, ""},
+		{"/echobin/redirect/2", http.StatusFound, "/echobin/relative-redirect/1"},
+		{"/echobin/relative-redirect/1", http.StatusFound, "/echobin/get"},
+		{"/echobin/cookies/set?a=b", http.StatusFound, "/echobin/cookies"},
+	}
+	for _, v := range cases {
+		req := httptest.NewRequest(http.MethodGet, v.target, nil)
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		assert.Equal(t, v.code, res.Code, v.target)
+		assert.Equal(t, v.location, res.Header().Get("Location"), v.target)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/echobin/links/3/0", nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Contains(t, res.Body.String(), `href="/echobin/links/3/1"`)
+}
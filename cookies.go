@@ -0,0 +1,422 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Cookie name prefixes which browsers only accept with certain attributes.
+// see also: https://datatracker.ietf.org/doc/html/draft-ietf-httpbis-rfc6265bis#section-4.1.3
+const (
+	cookiePrefixSecure = "__Secure-"
+	cookiePrefixHost   = "__Host-"
+)
+
+var sameSiteModes = map[string]http.SameSite{
+	"strict": http.SameSiteStrictMode,
+	"lax":    http.SameSiteLaxMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+type advancedCookieParams struct {
+	// Name of the cookie
+	Name string `json:"name" query:"name"`
+	// Value of the cookie
+	Value string `json:"value" query:"value"`
+	// Prefix added to the name, along with the attributes it requires
+	Prefix string `json:"prefix" query:"prefix" enums:"host,secure"`
+	// Max-Age in seconds, left out if negative
+	MaxAge int `json:"max_age" query:"max_age" default:"-1"`
+	// Expires as an HTTP date, or in seconds from now which may be negative
+	Expires     string `json:"expires" query:"expires"`
+	Domain      string `json:"domain" query:"domain"`
+	Path        string `json:"path" query:"path" default:"/"`
+	Secure      bool   `json:"secure" query:"secure"`
+	HTTPOnly    bool   `json:"http_only" query:"http_only"`
+	SameSite    string `json:"same_site" query:"same_site" enums:"strict,lax,none"`
+	Partitioned bool   `json:"partitioned" query:"partitioned"`
+	// Whether to redirect to the cookie list instead of describing the cookie
+	Redirect bool `json:"redirect" query:"redirect"`
+}
+
+// setCookie formats the Set-Cookie header of the cookie. http.Cookie doesn't
+// support the Partitioned attribute, so it's appended here.
+func (p *advancedCookieParams) setCookie() (string, error) {
+	cookie := &http.Cookie{
+		Name:     p.Name,
+		Value:    p.Value,
+		Domain:   p.Domain,
+		Path:     p.Path,
+		Secure:   p.Secure,
+		HttpOnly: p.HTTPOnly,
+	}
+	switch p.Prefix {
+	case "":
+	case "secure":
+		cookie.Name = cookiePrefixSecure + cookie.Name
+		cookie.Secure = true
+	case "host":
+		cookie.Name = cookiePrefixHost + cookie.Name
+		cookie.Secure = true
+		cookie.Domain = ""
+		cookie.Path = "/"
+	default:
+		return "", echo.NewHTTPError(http.StatusBadRequest, "prefix must be host or secure")
+	}
+	if p.MaxAge == 0 {
+		cookie.MaxAge = -1
+	} else if p.MaxAge > 0 {
+		cookie.MaxAge = p.MaxAge
+	}
+	if p.Expires != "" {
+		if seconds, err := strconv.Atoi(p.Expires); err == nil {
+			cookie.Expires = time.Now().Add(time.Duration(seconds) * time.Second)
+		} else if cookie.Expires, err = http.ParseTime(p.Expires); err != nil {
+			return "", echo.NewHTTPError(http.StatusBadRequest, "expires must be an HTTP date or a number of seconds")
+		}
+	}
+	if p.SameSite != "" {
+		mode, ok := sameSiteModes[strings.ToLower(p.SameSite)]
+		if !ok {
+			return "", echo.NewHTTPError(http.StatusBadRequest, "same_site must be strict, lax or none")
+		}
+		cookie.SameSite = mode
+	}
+	v := cookie.String()
+	if v == "" {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid cookie name")
+	}
+	if p.Partitioned {
+		v += "; Partitioned"
+	}
+	return v, nil
+}
+
+// cookieWarnings lists why browsers would reject or ignore the cookie.
+func cookieWarnings(setCookie string) []string {
+	warnings := []string{}
+	cookies := (&http.Response{Header: http.Header{echo.HeaderSetCookie: {setCookie}}}).Cookies()
+	if len(cookies) == 0 {
+		return append(warnings, "the cookie can't be parsed")
+	}
+	cookie := cookies[0]
+	partitioned := strings.HasSuffix(setCookie, "; Partitioned")
+	if strings.HasPrefix(cookie.Name, cookiePrefixSecure) && !cookie.Secure {
+		warnings = append(warnings, cookiePrefixSecure+" cookies must be Secure")
+	}
+	if strings.HasPrefix(cookie.Name, cookiePrefixHost) {
+		if !cookie.Secure {
+			warnings = append(warnings, cookiePrefixHost+" cookies must be Secure")
+		}
+		if cookie.Domain != "" {
+			warnings = append(warnings, cookiePrefixHost+" cookies must not have a Domain")
+		}
+		if cookie.Path != "/" {
+			warnings = append(warnings, cookiePrefixHost+" cookies must have the Path /")
+		}
+	}
+	if cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure {
+		warnings = append(warnings, "SameSite=None cookies must be Secure")
+	}
+	if partitioned && !cookie.Secure {
+		warnings = append(warnings, "Partitioned cookies must be Secure")
+	}
+	return warnings
+}
+
+// @Summary   Sets a cookie with any attributes, given by the query string or a JSON body.
+// @Tags      Cookies
+// @Accept    json
+// @Produce   json
+// @Param     advancedCookieParams  query     advancedCookieParams  false  "advancedCookieParams"
+// @Param     advancedCookieParams  body      advancedCookieParams  false  "advancedCookieParams"
+// @Success   200                   {object}  setCookieResponse
+// @Response  302                   "Redirect to cookie list"
+// @Router    /cookies/set-advanced [get]
+// @Router    /cookies/set-advanced [post]
+func setAdvancedCookieHandler(c echo.Context) error {
+	p := &advancedCookieParams{
+		MaxAge: -1,
+		Path:   "/",
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if err := (&echo.DefaultBinder{}).BindBody(c, p); err != nil {
+		return err
+	}
+	if p.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	setCookie, err := p.setCookie()
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Add(echo.HeaderSetCookie, setCookie)
+	if p.Redirect {
+		return c.Redirect(http.StatusFound, c.Echo().URI(getCookiesHandler))
+	}
+	return c.JSONPretty(http.StatusOK, &setCookieResponse{
+		SetCookie: setCookie,
+		Warnings:  cookieWarnings(setCookie),
+	}, "  ")
+}
+
+// cookieScenarioStep is a request of a cookie jar scenario. Each step sets
+// cookies and redirects to the next one, the last one verifies the jar.
+type cookieScenarioStep struct {
+	// Path of the step below the path of the scenario
+	path string
+	// Cookies of the scenario expected from the jar, nil if not checked
+	expect []string
+	// Whether the expected cookies must be in order
+	ordered bool
+	// Set-Cookie headers of the step, given the path of the scenario
+	setCookies func(base string) []string
+}
+
+type cookieScenario struct {
+	name        string
+	description string
+	// Names of the cookies of the scenario start with prefix
+	prefix string
+	steps  []cookieScenarioStep
+}
+
+const cookieEpoch = "Thu, 01 Jan 1970 00:00:00 GMT"
+
+var cookieScenarios = []cookieScenario{
+	{
+		name:        "redirect-paths",
+		description: "Cookies are only sent to their own path and below while following redirects.",
+		prefix:      "rp_",
+		steps: []cookieScenarioStep{
+			{path: "", setCookies: func(base string) []string {
+				return []string{"rp_root=1; Path=" + base, "rp_a=1; Path=" + base + "/a", "rp_b=1; Path=" + base + "/b"}
+			}},
+			{path: "/a/check", expect: []string{"rp_a=1", "rp_root=1"}},
+			{path: "/b/verify", expect: []string{"rp_b=1", "rp_root=1"}},
+		},
+	},
+	{
+		name:        "same-name-paths",
+		description: "Cookies with the same name but different paths are kept apart, and the one with the longer path is sent first.",
+		prefix:      "snp",
+		steps: []cookieScenarioStep{
+			{path: "", setCookies: func(base string) []string {
+				return []string{"snp=root; Path=" + base, "snp=deep; Path=" + base + "/deep"}
+			}},
+			{path: "/deep/verify", expect: []string{"snp=deep", "snp=root"}, ordered: true},
+		},
+	},
+	{
+		name:        "overwrite",
+		description: "Cookies with the same name, domain and path replace the stored one, within a response and across responses.",
+		prefix:      "ow",
+		steps: []cookieScenarioStep{
+			{path: "", setCookies: func(base string) []string {
+				return []string{"ow=zero; Path=" + base, "ow=first; Path=" + base, "ow_other=1; Path=" + base}
+			}},
+			{path: "/again", expect: []string{"ow=first", "ow_other=1"}, setCookies: func(base string) []string {
+				return []string{"ow=second; Path=" + base}
+			}},
+			{path: "/verify", expect: []string{"ow=second", "ow_other=1"}},
+		},
+	},
+	{
+		name:        "expiry",
+		description: "Cookies expiring in the past aren't stored, and remove the stored cookie they replace.",
+		prefix:      "exp_",
+		steps: []cookieScenarioStep{
+			{path: "", setCookies: func(base string) []string {
+				return []string{
+					"exp_keep=1; Path=" + base,
+					"exp_expires=1; Path=" + base,
+					"exp_max_age=1; Path=" + base,
+					"exp_never=1; Path=" + base + "; Expires=" + cookieEpoch,
+				}
+			}},
+			{path: "/delete", expect: []string{"exp_keep=1", "exp_expires=1", "exp_max_age=1"}, setCookies: func(base string) []string {
+				return []string{"exp_expires=; Path=" + base + "; Expires=" + cookieEpoch, "exp_max_age=; Path=" + base + "; Max-Age=0"}
+			}},
+			{path: "/verify", expect: []string{"exp_keep=1"}},
+		},
+	},
+	{
+		name:        "set-on-redirect",
+		description: "Cookies set by redirect responses are stored, whatever the redirect status is.",
+		prefix:      "sor",
+		steps: []cookieScenarioStep{
+			{path: "", setCookies: func(base string) []string {
+				return []string{"sor=1; Path=" + base}
+			}},
+			{path: "/verify", expect: []string{"sor=1"}},
+		},
+	},
+	{
+		name:        "oversize",
+		description: "Cookies whose name and value are longer than 4096 bytes are ignored.",
+		prefix:      "os_",
+		steps: []cookieScenarioStep{
+			{path: "", setCookies: func(base string) []string {
+				return []string{
+					"os_fit=" + strings.Repeat("a", 4096-len("os_fit")) + "; Path=" + base,
+					"os_big=" + strings.Repeat("a", 4097-len("os_big")) + "; Path=" + base,
+				}
+			}},
+			{path: "/verify", expect: []string{"os_fit=" + strings.Repeat("a", 4096-len("os_fit"))}},
+		},
+	},
+}
+
+type cookieScenarioParams struct {
+	// Status of the redirects between the steps
+	Status int `query:"status" enums:"301,302,303,307,308" default:"302"`
+}
+
+// @Summary  Lists the cookie jar scenarios. Clients start a scenario by requesting its URL and following redirects, and are told whether their cookie jar behaved per RFC 6265bis.
+// @Tags     Cookies
+// @Produce  json
+// @Success  200  {array}  cookieScenarioInfo
+// @Router   /cookies/scenarios [get]
+func cookieScenariosHandler(c echo.Context) error {
+	infos := make([]cookieScenarioInfo, len(cookieScenarios))
+	for i, s := range cookieScenarios {
+		infos[i] = cookieScenarioInfo{
+			Name:        s.name,
+			Description: s.description,
+			URL:         conf.Routes.BasePath + "/cookies/scenarios/" + s.name,
+		}
+	}
+	return c.JSONPretty(http.StatusOK, infos, "  ")
+}
+
+// @Summary   Runs a step of a cookie jar scenario, the last one tells whether the cookie jar behaved per RFC 6265bis and deletes the cookies of the scenario.
+// @Tags      Cookies
+// @Produce   json
+// @Param     name                  path      string                true   "Name of the scenario"  Enums(redirect-paths, same-name-paths, overwrite, expiry, set-on-redirect, oversize)
+// @Param     cookieScenarioParams  query     cookieScenarioParams  false  "cookieScenarioParams"
+// @Success   200                   {object}  cookieScenarioResponse
+// @Response  302                   "Redirect to the next step, with the given status"
+// @Router    /cookies/scenarios/{name} [get]
+func cookieScenarioHandler(c echo.Context) error {
+	var scenario *cookieScenario
+	for i := range cookieScenarios {
+		if cookieScenarios[i].name == c.Param("name") {
+			scenario = &cookieScenarios[i]
+		}
+	}
+	if scenario == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "unknown scenario")
+	}
+	step := -1
+	for i, s := range scenario.steps {
+		if s.path == strings.TrimSuffix("/"+c.Param("*"), "/") {
+			step = i
+		}
+	}
+	if step < 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "unknown step")
+	}
+	p := &cookieScenarioParams{Status: http.StatusFound}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	switch p.Status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "status must be one of 301, 302, 303, 307 and 308")
+	}
+
+	base := conf.Routes.BasePath + "/cookies/scenarios/" + scenario.name
+	received := []string{}
+	for _, cookie := range c.Request().Cookies() {
+		if strings.HasPrefix(cookie.Name, scenario.prefix) {
+			received = append(received, cookie.Name+"="+cookie.Value)
+		}
+	}
+	current := scenario.steps[step]
+	if current.setCookies != nil {
+		for _, v := range current.setCookies(base) {
+			c.Response().Header().Add(echo.HeaderSetCookie, v)
+		}
+	}
+
+	// The cookies received by earlier steps are passed along in the query
+	// string, keyed by the path of the step.
+	query := c.QueryParams()
+	if current.expect != nil {
+		query.Set(current.path, strings.Join(received, "; "))
+	}
+	if step < len(scenario.steps)-1 {
+		query.Set("status", strconv.Itoa(p.Status))
+		return c.Redirect(p.Status, base+scenario.steps[step+1].path+"?"+query.Encode())
+	}
+
+	res := &cookieScenarioResponse{
+		Scenario: scenario.name,
+		Passed:   true,
+		Checks:   []cookieScenarioCheck{},
+	}
+	for _, s := range scenario.steps {
+		if s.expect == nil {
+			continue
+		}
+		check := cookieScenarioCheck{
+			Step:     base + s.path,
+			Ordered:  s.ordered,
+			Expected: s.expect,
+			Received: []string{},
+		}
+		if values, ok := query[s.path]; ok {
+			if values[0] != "" {
+				check.Received = strings.Split(values[0], "; ")
+			}
+			check.Passed = sameCookies(check.Expected, check.Received, s.ordered)
+		} else {
+			check.Error = "the step was skipped"
+		}
+		res.Passed = res.Passed && check.Passed
+		res.Checks = append(res.Checks, check)
+	}
+
+	// Clean up, so that the scenario can be run again
+	deleted := map[string]bool{}
+	for _, s := range scenario.steps {
+		if s.setCookies == nil {
+			continue
+		}
+		header := http.Header{echo.HeaderSetCookie: s.setCookies(base)}
+		for _, cookie := range (&http.Response{Header: header}).Cookies() {
+			if v := (&http.Cookie{Name: cookie.Name, Path: cookie.Path, MaxAge: -1}).String(); !deleted[v] {
+				deleted[v] = true
+				c.Response().Header().Add(echo.HeaderSetCookie, v)
+			}
+		}
+	}
+	return c.JSONPretty(http.StatusOK, res, "  ")
+}
+
+// sameCookies reports whether the received cookies are the expected ones.
+func sameCookies(expected, received []string, ordered bool) bool {
+	if len(expected) != len(received) {
+		return false
+	}
+	if !ordered {
+		expected = append([]string{}, expected...)
+		received = append([]string{}, received...)
+		sort.Strings(expected)
+		sort.Strings(received)
+	}
+	for i := range expected {
+		if expected[i] != received[i] {
+			return false
+		}
+	}
+	return true
+}
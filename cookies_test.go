@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetAdvancedCookieHandler(t *testing.T) {
+	e := newEcho()
+	do := func(method, target, body string) (*httptest.ResponseRecorder, setCookieResponse) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		}
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		sc := setCookieResponse{}
+		json.Unmarshal(res.Body.Bytes(), &sc)
+		return res, sc
+	}
+
+	cases := []struct {
+		target    string
+		setCookie string
+		warnings  []string
+	}{
+		{"/cookies/set-advanced?name=a&value=b", "a=b; Path=/", []string{}},
+		{"/cookies/set-advanced?name=a&value=b&path=/x&domain=example.com&max_age=60&secure=true&http_only=true&same_site=Lax",
+			"a=b; Path=/x; Domain=example.com; Max-Age=60; HttpOnly; Secure; SameSite=Lax", []string{}},
+		{"/cookies/set-advanced?name=a&max_age=0&expires=Tue,%2022%20Feb%202022%2000:00:00%20GMT",
+			"a=; Path=/; Expires=Tue, 22 Feb 2022 00:00:00 GMT; Max-Age=0", []string{}},
+		{"/cookies/set-advanced?name=a&value=b&same_site=none&partitioned=true",
+			"a=b; Path=/; SameSite=None; Partitioned", []string{"SameSite=None cookies must be Secure", "Partitioned cookies must be Secure"}},
+		{"/cookies/set-advanced?name=a&value=b&same_site=none&secure=true&partitioned=true",
+			"a=b; Path=/; Secure; SameSite=None; Partitioned", []string{}},
+		// prefixes come with the attributes they need
+		{"/cookies/set-advanced?name=a&value=b&prefix=secure", "__Secure-a=b; Path=/; Secure", []string{}},
+		{"/cookies/set-advanced?name=a&value=b&prefix=host&path=/x&domain=example.com", "__Host-a=b; Path=/; Secure", []string{}},
+		// unless they are part of the name
+		{"/cookies/set-advanced?name=__Secure-a&value=b", "__Secure-a=b; Path=/", []string{"__Secure- cookies must be Secure"}},
+		{"/cookies/set-advanced?name=__Host-a&value=b&path=/x&domain=example.com&secure=true",
+			"__Host-a=b; Path=/x; Domain=example.com; Secure", []string{"__Host- cookies must not have a Domain", "__Host- cookies must have the Path /"}},
+	}
+	for _, v := range cases {
+		res, sc := do(http.MethodGet, v.target, "")
+		assert.Equal(t, http.StatusOK, res.Code, v.target)
+		assert.Equal(t, v.setCookie, res.Header().Get("Set-Cookie"), v.target)
+		assert.Equal(t, v.setCookie, sc.SetCookie, v.target)
+		assert.Equal(t, v.warnings, sc.Warnings, v.target)
+	}
+
+	// expires in seconds from now
+	res, _ := do(http.MethodGet, "/cookies/set-advanced?name=a&expires=3600", "")
+	cookies := res.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), cookies[0].Expires, 2*time.Second)
+	}
+
+	// JSON bodies
+	res, sc := do(http.MethodPost, "/cookies/set-advanced", `{"name": "a", "value": "b", "max_age": 10, "http_only": true, "same_site": "strict"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "a=b; Path=/; Max-Age=10; HttpOnly; SameSite=Strict", sc.SetCookie)
+
+	res, _ = do(http.MethodGet, "/cookies/set-advanced?name=a&value=b&redirect=true", "")
+	assert.Equal(t, http.StatusFound, res.Code)
+	assert.Equal(t, "/cookies", res.Header().Get("Location"))
+
+	for _, target := range []string{
+		"/cookies/set-advanced?value=b",
+		"/cookies/set-advanced?name=a%20b",
+		"/cookies/set-advanced?name=a&same_site=always",
+		"/cookies/set-advanced?name=a&prefix=other",
+		"/cookies/set-advanced?name=a&expires=tomorrow",
+	} {
+		res, _ := do(http.MethodGet, target, "")
+		assert.Equal(t, http.StatusBadRequest, res.Code, target)
+	}
+}
+
+func TestCookieScenarioHandler(t *testing.T) {
+	s := httptest.NewServer(newEcho())
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/cookies/scenarios")
+	if assert.NoError(t, err) {
+		infos := []cookieScenarioInfo{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&infos))
+		res.Body.Close()
+		assert.Len(t, infos, len(cookieScenarios))
+	}
+
+	for _, sc := range cookieScenarios {
+		for _, status := range []string{"302", "307"} {
+			jar, _ := cookiejar.New(nil)
+			client := &http.Client{Jar: jar}
+			res, err := client.Get(s.URL + "/cookies/scenarios/" + sc.name + "?status=" + status)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			result := cookieScenarioResponse{}
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+			res.Body.Close()
+			assert.Equal(t, sc.name, result.Scenario)
+			assert.NotEmpty(t, result.Checks)
+			// Go's cookie jar doesn't limit the size of cookies
+			assert.Equal(t, sc.name != "oversize", result.Passed, sc.name)
+
+			// cookies are deleted by the last step
+			u, _ := url.Parse(s.URL + "/cookies/scenarios/" + sc.name + "/deep/a/b")
+			assert.Empty(t, jar.Cookies(u), sc.name)
+		}
+	}
+
+	// jars which don't follow redirects fail
+	res, err = http.Get(s.URL + "/cookies/scenarios/overwrite/verify")
+	if assert.NoError(t, err) {
+		result := cookieScenarioResponse{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+		res.Body.Close()
+		assert.False(t, result.Passed)
+		if assert.Len(t, result.Checks, 2) {
+			assert.Equal(t, "the step was skipped", result.Checks[0].Error)
+			assert.Equal(t, []string{}, result.Checks[1].Received)
+		}
+	}
+
+	for target, code := range map[string]int{
+		"/cookies/scenarios/unknown":              http.StatusNotFound,
+		"/cookies/scenarios/overwrite/unknown":    http.StatusNotFound,
+		"/cookies/scenarios/overwrite?status=200": http.StatusBadRequest,
+	} {
+		res, err := http.Get(s.URL + target)
+		if assert.NoError(t, err) {
+			res.Body.Close()
+			assert.Equal(t, code, res.StatusCode, target)
+		}
+	}
+}
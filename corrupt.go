@@ -0,0 +1,195 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+)
+
+var magicBytes = map[string][]byte{
+	"png":  []byte("\x89PNG\r\n\x1a\n"),
+	"jpeg": []byte("\xff\xd8\xff"),
+	"gif":  []byte("GIF89a"),
+	"webp": []byte("RIFF\x00\x00\x00\x00WEBP"),
+	"pdf":  []byte("%PDF-"),
+	"zip":  []byte("PK\x03\x04"),
+	"gzip": []byte("\x1f\x8b"),
+	"elf":  []byte("\x7fELF"),
+}
+
+type corruptParams struct {
+	// Truncate the body at given number of bytes
+	Truncate int `query:"truncate"`
+	// The number of random bits to flip, at most the number of bits of the body
+	FlipBits int `query:"flip_bits"`
+	// Overwrite the start of the body with the magic bytes of another format
+	Magic string `query:"magic" enums:"png,jpeg,gif,webp,pdf,zip,gzip,elf"`
+	// Content-Type to declare instead of the real one
+	ContentType string `query:"content_type"`
+	// Content-Length to declare regardless of the actual length, only works with HTTP/1.x
+	ContentLength int `query:"content_length"`
+}
+
+// writeMedia responds with body like c.Blob, corrupted as requested with
+// corruptParams. r is the random source of flipped bits, one is created
+// from the seed parameter when nil.
+func writeMedia(c echo.Context, contentType string, body []byte, r *rand.Rand) error {
+	cp := &corruptParams{
+		Truncate:      -1,
+		ContentLength: -1,
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, cp); err != nil {
+		return err
+	}
+	if cp.FlipBits < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid number of bits")
+	}
+	if cp.Magic != "" || cp.FlipBits > 0 {
+		// body may be an embedded file, which must not be modified
+		body = append([]byte{}, body...)
+	}
+	if cp.Magic != "" {
+		magic, ok := magicBytes[cp.Magic]
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "unknown magic")
+		}
+		if len(body) < len(magic) {
+			body = append(body, magic[len(body):]...)
+		}
+		copy(body, magic)
+	}
+	if cp.FlipBits > 0 && len(body) > 0 {
+		if cp.FlipBits > len(body)*8 {
+			cp.FlipBits = len(body) * 8
+		}
+		if r == nil {
+			var err error
+			if r, err = getRand(c); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < cp.FlipBits; i++ {
+			bit := r.Intn(len(body) * 8)
+			body[bit/8] ^= 1 << (bit % 8)
+		}
+	}
+	if cp.Truncate >= 0 && cp.Truncate < len(body) {
+		body = body[:cp.Truncate]
+	}
+	if cp.ContentType != "" {
+		contentType = cp.ContentType
+	}
+	if cp.ContentLength < 0 || cp.ContentLength == len(body) {
+		return c.Blob(http.StatusOK, contentType, body)
+	}
+	return writeWrongLength(c, contentType, body, cp.ContentLength)
+}
+
+// writeWrongLength writes a response declaring a Content-Length different
+// from the length of body, which net/http refuses to do, by writing directly
+// to the hijacked connection.
+func writeWrongLength(c echo.Context, contentType string, body []byte, length int) error {
+	hj, ok := c.Response().Writer.(http.Hijacker)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotImplemented, "a wrong Content-Length can only be declared with HTTP/1.x")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, contentType)
+	h.Set(echo.HeaderContentLength, strconv.Itoa(length))
+	h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	h.Set("Connection", "close")
+	fmt.Fprintf(rw, "HTTP/1.1 %d %s\r\n", http.StatusOK, http.StatusText(http.StatusOK))
+	h.Write(rw)
+	rw.WriteString("\r\n")
+	rw.Write(body)
+	return rw.Flush()
+}
+
+type bombParams struct {
+	// Compression of the payload
+	Encoding string `query:"encoding" default:"gzip" enums:"gzip,deflate,br"`
+	// Serve the compressed payload as a file instead of with Content-Encoding
+	Raw bool `query:"raw"`
+}
+
+var bombTypes = map[string]string{
+	"gzip":    "application/gzip",
+	"deflate": "application/zlib",
+	"br":      echo.MIMEOctetStream,
+}
+
+// @Summary   Returns a small, highly compressed response which expands to n zero bytes.
+// @Tags      Response formats
+// @Produce   octet-stream
+// @Param     n           path   int         true   "Decompressed size in bytes"  default(1048576)
+// @Param     bombParams  query  bombParams  false  "bombParams"
+// @Response  200         "Compressed zeros."
+// @Response  400         "Invalid parameters."
+// @Router    /bomb/{n} [get]
+func bombHandler(c echo.Context) error {
+	n, err := strconv.Atoi(c.Param("n"))
+	if err != nil || n < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid number of bytes")
+	}
+	if n > conf.Limits.MaxBombBytes {
+		n = conf.Limits.MaxBombBytes
+	}
+	bp := &bombParams{
+		Encoding: "gzip",
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, bp); err != nil {
+		return err
+	}
+	contentType, ok := bombTypes[bp.Encoding]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown encoding")
+	}
+
+	h := c.Response().Header()
+	if bp.Raw {
+		h.Set(echo.HeaderContentType, contentType)
+		h.Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="bomb.%s"`, bp.Encoding))
+	} else {
+		h.Set(echo.HeaderContentType, echo.MIMEOctetStream)
+		h.Set(echo.HeaderContentEncoding, bp.Encoding)
+	}
+	c.Response().WriteHeader(http.StatusOK)
+
+	var w io.WriteCloser
+	switch bp.Encoding {
+	case "gzip":
+		w, _ = gzip.NewWriterLevel(c.Response(), gzip.BestSpeed)
+	case "deflate":
+		w, _ = zlib.NewWriterLevel(c.Response(), zlib.BestSpeed)
+	case "br":
+		w = brotli.NewWriterLevel(c.Response(), 5)
+	}
+	zeros := make([]byte, 32<<10)
+	for n > 0 {
+		if err := pause(c, 0); err != nil {
+			return err
+		}
+		chunk := zeros
+		if n < len(chunk) {
+			chunk = chunk[:n]
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		n -= len(chunk)
+	}
+	return w.Close()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMedia(t *testing.T) {
+	e := newEcho()
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+
+	res := get("/image/png?truncate=100")
+	assert.Equal(t, samplePNG[:100], res.Body.Bytes())
+	assert.Equal(t, "image/png", res.Header().Get("Content-Type"))
+
+	res = get("/image/png?magic=gif&content_type=image/jpeg")
+	assert.Equal(t, "image/jpeg", res.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(res.Body.Bytes(), []byte("GIF89a")))
+	assert.Equal(t, samplePNG[6:], res.Body.Bytes()[6:])
+	assert.Equal(t, []byte("\x89PNG"), samplePNG[:4], "embedded image must not be modified")
+
+	res = get("/bytes/2?magic=png")
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\n"), res.Body.Bytes())
+
+	// bits are flipped reproducibly
+	res1, res2 := get("/image/jpeg?flip_bits=10&seed=1"), get("/image/jpeg?flip_bits=10&seed=1")
+	assert.Equal(t, res1.Body.Bytes(), res2.Body.Bytes())
+	assert.Equal(t, len(sampleJPEG), res1.Body.Len())
+	diff := 0
+	for i, b := range res1.Body.Bytes() {
+		for x := b ^ sampleJPEG[i]; x != 0; x &= x - 1 {
+			diff++
+		}
+	}
+	assert.True(t, diff > 0 && diff <= 10, diff)
+	assert.NotEqual(t, res1.Body.Bytes(), get("/image/jpeg?flip_bits=10&seed=2").Body.Bytes())
+	assert.Equal(t, get("/bytes/100?seed=1").Body.Bytes(), get("/bytes/100?seed=1&flip_bits=0").Body.Bytes())
+	assert.NotEqual(t, get("/bytes/100?seed=1").Body.Bytes(), get("/bytes/100?seed=1&flip_bits=1").Body.Bytes())
+
+	assert.Equal(t, http.StatusBadRequest, get("/image/png?magic=exe").Code)
+	// no more bits are flipped than the body has
+	start := time.Now()
+	assert.Len(t, get("/bytes/100?flip_bits=200000000").Body.Bytes(), 100)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusBadRequest, get("/image/png?flip_bits=-1").Code)
+	// recorders can't be hijacked
+	assert.Equal(t, http.StatusNotImplemented, get("/image/png?content_length=10").Code)
+}
+
+func TestWriteMediaWrongContentLength(t *testing.T) {
+	s := httptest.NewServer(newEcho())
+	defer s.Close()
+
+	for _, length := range []string{"10", "1000"} {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		if !assert.NoError(t, err) {
+			return
+		}
+		io.WriteString(conn, "GET /bytes/100?content_length="+length+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		raw, _ := io.ReadAll(conn)
+		conn.Close()
+
+		res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, length, res.Header.Get("Content-Length"))
+		}
+		// the whole body is sent anyway
+		parts := strings.SplitN(string(raw), "\r\n\r\n", 2)
+		assert.Len(t, parts[1], 100)
+	}
+}
+
+func TestBombHandler(t *testing.T) {
+	e := newEcho()
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) {
+			return zlib.NewReader(r)
+		},
+		"br": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for encoding, decode := range decoders {
+		res := get("/bomb/10000000?encoding=" + encoding)
+		assert.Equal(t, encoding, res.Header().Get("Content-Encoding"))
+		assert.Less(t, res.Body.Len(), 20000, encoding)
+		r, err := decode(res.Body)
+		if assert.NoError(t, err) {
+			n, err := io.Copy(io.Discard, r)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(10000000), n, encoding)
+		}
+	}
+
+	res := get("/bomb/100?raw=true")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/gzip", res.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="bomb.gzip"`, res.Header().Get("Content-Disposition"))
+
+	// the size is capped
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Limits.MaxBombBytes = 1000
+	r, err := gzip.NewReader(get("/bomb/10000000").Body)
+	if assert.NoError(t, err) {
+		n, _ := io.Copy(io.Discard, r)
+		assert.Equal(t, int64(1000), n)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get("/bomb/-1").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/bomb/1?encoding=zip").Code)
+}
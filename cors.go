@@ -0,0 +1,210 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Private Network Access headers, see https://wicg.github.io/private-network-access/
+const (
+	headerAccessControlRequestPrivateNetwork = "Access-Control-Request-Private-Network"
+	headerAccessControlAllowPrivateNetwork   = "Access-Control-Allow-Private-Network"
+	headerPrivateNetworkAccessID             = "Private-Network-Access-ID"
+	headerPrivateNetworkAccessName           = "Private-Network-Access-Name"
+)
+
+// corsResponseHeaders are the headers listed in the responses of /cors.
+var corsResponseHeaders = []string{
+	echo.HeaderAccessControlAllowOrigin,
+	echo.HeaderAccessControlAllowCredentials,
+	echo.HeaderAccessControlExposeHeaders,
+	echo.HeaderVary,
+}
+
+type corsParams struct {
+	// Access-Control-Allow-Origin, the Origin of the request if empty, left out if none
+	AllowOrigin string `query:"allow_origin"`
+	// Access-Control-Allow-Credentials
+	AllowCredentials bool `query:"allow_credentials"`
+	// Access-Control-Allow-Methods of preflights, the requested method if empty
+	AllowMethods []string `query:"allow_methods"`
+	// Access-Control-Allow-Headers of preflights, the requested headers if empty
+	AllowHeaders []string `query:"allow_headers"`
+	// Access-Control-Expose-Headers
+	ExposeHeaders []string `query:"expose_headers"`
+	// Access-Control-Max-Age of preflights in seconds, left out if negative
+	MaxAge int `query:"max_age" default:"-1"`
+	// Status of preflights, browsers fail preflights unless it is 2xx
+	PreflightStatus int `query:"preflight_status" default:"204"`
+	// Whether preflights fail by leaving out all CORS headers
+	FailPreflight bool `query:"fail_preflight"`
+	// Whether preflights requesting private network access are allowed to
+	AllowPrivateNetwork bool `query:"allow_private_network" default:"true"`
+	// Private-Network-Access-ID of preflights requesting private network access, left out if empty
+	PrivateNetworkID string `query:"private_network_id"`
+	// Private-Network-Access-Name of preflights requesting private network access, left out if empty
+	PrivateNetworkName string `query:"private_network_name"`
+}
+
+// corsPreflightLog remembers the latest preflights received by /cors.
+type corsPreflightLog struct {
+	mu      sync.Mutex
+	entries []corsPreflight
+}
+
+var corsPreflights = &corsPreflightLog{}
+
+func (l *corsPreflightLog) add(p corsPreflight) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, p)
+	if n := len(l.entries) - conf.Limits.MaxCORSPreflights; n > 0 {
+		l.entries = append(l.entries[:0], l.entries[n:]...)
+	}
+}
+
+// last returns the latest preflight from origin for the method and path.
+func (l *corsPreflightLog) last(origin, method, path string) *corsPreflight {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		p := l.entries[i]
+		if p.Origin == origin && p.Method == method && p.Path == path {
+			return &p
+		}
+	}
+	return nil
+}
+
+// isCORSPlayground tells the global CORS middleware to leave /cors alone, it
+// sets the headers as requested.
+func isCORSPlayground(c echo.Context) bool {
+	p := strings.TrimPrefix(c.Path(), conf.Routes.BasePath)
+	return p == "/cors" || strings.HasPrefix(p, "/cors/")
+}
+
+// @Summary   Responds with the CORS headers given by the query, which is the same for preflights and actual requests, ignoring the global CORS settings. Actual requests are answered with the last preflight received from their origin for their path and method.
+// @Tags      Response inspection
+// @Accept    json
+// @Produce   json
+// @Param     allow_origin                            query     string        false  "Access-Control-Allow-Origin, the Origin of the request if empty, left out if none"
+// @Param     allow_credentials                       query     bool          false  "Access-Control-Allow-Credentials"
+// @Param     allow_methods                           query     []string      false  "Access-Control-Allow-Methods of preflights, the requested method if empty"   collectionFormat(multi)
+// @Param     allow_headers                           query     []string      false  "Access-Control-Allow-Headers of preflights, the requested headers if empty"  collectionFormat(multi)
+// @Param     expose_headers                          query     []string      false  "Access-Control-Expose-Headers"                                               collectionFormat(multi)
+// @Param     max_age                                 query     int           false  "Access-Control-Max-Age of preflights in seconds, left out if negative"       default(-1)
+// @Param     preflight_status                        query     int           false  "Status of preflights, browsers fail preflights unless it is 2xx"             default(204)
+// @Param     fail_preflight                          query     bool          false  "Whether preflights fail by leaving out all CORS headers"
+// @Param     allow_private_network                   query     bool          false  "Whether preflights requesting private network access are allowed to"  default(true)
+// @Param     private_network_id                      query     string        false  "Private-Network-Access-ID of preflights requesting private network access, left out if empty"
+// @Param     private_network_name                    query     string        false  "Private-Network-Access-Name of preflights requesting private network access, left out if empty"
+// @Param     Origin                                  header    string        false  "Origin"
+// @Param     Access-Control-Request-Method           header    string        false  "Access-Control-Request-Method"
+// @Param     Access-Control-Request-Headers          header    string        false  "Access-Control-Request-Headers"
+// @Param     Access-Control-Request-Private-Network  header    string        false  "Access-Control-Request-Private-Network"
+// @Success   200                                     {object}  corsResponse  "The actual request"
+// @Response  204                                     "A preflight"
+// @Router    /cors [delete]
+// @Router    /cors [get]
+// @Router    /cors [options]
+// @Router    /cors [patch]
+// @Router    /cors [post]
+// @Router    /cors [put]
+func corsHandler(c echo.Context) error {
+	p := &corsParams{
+		MaxAge:              -1,
+		PreflightStatus:     http.StatusNoContent,
+		AllowPrivateNetwork: true,
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if p.PreflightStatus < 200 || p.PreflightStatus > 599 {
+		return echo.NewHTTPError(http.StatusBadRequest, "preflight_status must be in the range [200, 599]")
+	}
+
+	req := c.Request()
+	h := c.Response().Header()
+	origin := req.Header.Get(echo.HeaderOrigin)
+	requestMethod := req.Header.Get(echo.HeaderAccessControlRequestMethod)
+	preflight := req.Method == http.MethodOptions && origin != "" && requestMethod != ""
+
+	if !preflight || !p.FailPreflight {
+		switch p.AllowOrigin {
+		case "none":
+		case "":
+			if origin != "" {
+				h.Set(echo.HeaderAccessControlAllowOrigin, origin)
+				h.Add(echo.HeaderVary, echo.HeaderOrigin)
+			}
+		default:
+			h.Set(echo.HeaderAccessControlAllowOrigin, p.AllowOrigin)
+		}
+		if p.AllowCredentials {
+			h.Set(echo.HeaderAccessControlAllowCredentials, "true")
+		}
+	}
+
+	if !preflight {
+		if len(p.ExposeHeaders) > 0 {
+			h.Set(echo.HeaderAccessControlExposeHeaders, strings.Join(p.ExposeHeaders, ", "))
+		}
+		res := &corsResponse{
+			Origin:    origin,
+			Method:    req.Method,
+			Headers:   map[string]string{},
+			Preflight: corsPreflights.last(origin, req.Method, req.URL.Path),
+		}
+		for _, k := range corsResponseHeaders {
+			if v := h.Values(k); len(v) > 0 {
+				res.Headers[k] = strings.Join(v, ", ")
+			}
+		}
+		return c.JSONPretty(http.StatusOK, res, "  ")
+	}
+
+	record := corsPreflight{
+		Time:           time.Now().UTC(),
+		Origin:         origin,
+		Path:           req.URL.Path,
+		Method:         requestMethod,
+		Headers:        splitHeaderList(req.Header.Values(echo.HeaderAccessControlRequestHeaders)),
+		PrivateNetwork: req.Header.Get(headerAccessControlRequestPrivateNetwork) == "true",
+		Status:         p.PreflightStatus,
+	}
+	corsPreflights.add(record)
+	if p.FailPreflight {
+		return c.NoContent(p.PreflightStatus)
+	}
+
+	methods := p.AllowMethods
+	if len(methods) == 0 {
+		methods = []string{requestMethod}
+	}
+	h.Set(echo.HeaderAccessControlAllowMethods, strings.Join(methods, ", "))
+	headers := p.AllowHeaders
+	if len(headers) == 0 {
+		headers = record.Headers
+	}
+	if len(headers) > 0 {
+		h.Set(echo.HeaderAccessControlAllowHeaders, strings.Join(headers, ", "))
+	}
+	if p.MaxAge >= 0 {
+		h.Set(echo.HeaderAccessControlMaxAge, strconv.Itoa(p.MaxAge))
+	}
+	if record.PrivateNetwork && p.AllowPrivateNetwork {
+		h.Set(headerAccessControlAllowPrivateNetwork, "true")
+		if p.PrivateNetworkID != "" {
+			h.Set(headerPrivateNetworkAccessID, p.PrivateNetworkID)
+		}
+		if p.PrivateNetworkName != "" {
+			h.Set(headerPrivateNetworkAccessName, p.PrivateNetworkName)
+		}
+	}
+	return c.NoContent(p.PreflightStatus)
+}
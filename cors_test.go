@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSHandler(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Limits.MaxCORSPreflights = 2
+	e := newEcho()
+	serve := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+	preflight := map[string]string{
+		echo.HeaderOrigin:                        "https://example.com",
+		echo.HeaderAccessControlRequestMethod:    http.MethodPut,
+		echo.HeaderAccessControlRequestHeaders:   "x-a, x-b",
+		headerAccessControlRequestPrivateNetwork: "true",
+	}
+
+	// the requested method and headers are allowed by default
+	res := serve(http.MethodOptions, "/cors/a", preflight)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	h := res.Header()
+	assert.Equal(t, "https://example.com", h.Get(echo.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, []string{echo.HeaderOrigin}, h.Values(echo.HeaderVary))
+	assert.Equal(t, http.MethodPut, h.Get(echo.HeaderAccessControlAllowMethods))
+	assert.Equal(t, "x-a, x-b", h.Get(echo.HeaderAccessControlAllowHeaders))
+	assert.Equal(t, "true", h.Get(headerAccessControlAllowPrivateNetwork))
+	assert.Empty(t, h.Get(echo.HeaderAccessControlMaxAge))
+
+	res = serve(http.MethodOptions, "/cors/a?allow_origin=*&allow_credentials=true&allow_methods=GET&allow_methods=POST&allow_headers=x-c&max_age=600&allow_private_network=false", preflight)
+	h = res.Header()
+	assert.Equal(t, "*", h.Get(echo.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, "true", h.Get(echo.HeaderAccessControlAllowCredentials))
+	assert.Equal(t, "GET, POST", h.Get(echo.HeaderAccessControlAllowMethods))
+	assert.Equal(t, "x-c", h.Get(echo.HeaderAccessControlAllowHeaders))
+	assert.Equal(t, "600", h.Get(echo.HeaderAccessControlMaxAge))
+	assert.Empty(t, h.Get(headerAccessControlAllowPrivateNetwork))
+
+	res = serve(http.MethodOptions, "/cors/b?fail_preflight=true&preflight_status=403", preflight)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Empty(t, res.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	assert.Empty(t, res.Header().Get(echo.HeaderAccessControlAllowMethods))
+
+	// actual requests report their last preflight
+	res = serve(http.MethodPut, "/cors/b?expose_headers=x-d&allow_origin=none", map[string]string{echo.HeaderOrigin: "https://example.com"})
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "x-d", res.Header().Get(echo.HeaderAccessControlExposeHeaders))
+	assert.Empty(t, res.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	cr := corsResponse{}
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &cr)) && assert.NotNil(t, cr.Preflight) {
+		assert.Equal(t, http.MethodPut, cr.Method)
+		assert.Equal(t, map[string]string{echo.HeaderAccessControlExposeHeaders: "x-d"}, cr.Headers)
+		assert.Equal(t, "/cors/b", cr.Preflight.Path)
+		assert.Equal(t, []string{"x-a", "x-b"}, cr.Preflight.Headers)
+		assert.True(t, cr.Preflight.PrivateNetwork)
+		assert.Equal(t, http.StatusForbidden, cr.Preflight.Status)
+	}
+	// only the latest preflights are remembered
+	res = serve(http.MethodPut, "/cors/a", map[string]string{echo.HeaderOrigin: "https://example.com"})
+	cr = corsResponse{}
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &cr)) && assert.NotNil(t, cr.Preflight) {
+		assert.Equal(t, http.StatusNoContent, cr.Preflight.Status)
+	}
+	serve(http.MethodOptions, "/cors", preflight)
+	serve(http.MethodOptions, "/cors", preflight)
+	res = serve(http.MethodPut, "/cors/a", map[string]string{echo.HeaderOrigin: "https://example.com"})
+	cr = corsResponse{}
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &cr)) {
+		assert.Nil(t, cr.Preflight)
+	}
+
+	// other routes keep the global CORS settings
+	res = serve(http.MethodOptions, "/get", preflight)
+	assert.Equal(t, "*", res.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/cors?preflight_status=99", nil).Code)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+type language struct {
+	words []string
+	// separator between words, empty for languages written without spaces
+	space string
+	comma string
+	stop  string
+	rtl   bool
+}
+
+var languages = map[string]*language{
+	"la": {words: fakeWords, space: " ", comma: ",", stop: "."},
+	"en": {words: []string{"the", "quick", "brown", "fox", "jumps", "over", "a", "lazy", "dog", "river", "mountain", "city", "light", "morning", "story", "garden", "window", "quiet", "bright", "people", "water", "small", "ancient", "road", "music"}, space: " ", comma: ",", stop: "."},
+	"de": {words: []string{"der", "die", "das", "und", "schnell", "Haus", "Baum", "Wasser", "über", "Straße", "schön", "Stadt", "grün", "Licht", "Morgen", "Geschichte", "Garten", "Fenster", "ruhig", "Menschen", "klein", "alt", "Weg", "Musik", "Bär"}, space: " ", comma: ",", stop: "."},
+	"fr": {words: []string{"le", "la", "et", "maison", "arbre", "eau", "été", "château", "rue", "belle", "ville", "vert", "lumière", "matin", "histoire", "jardin", "fenêtre", "calme", "gens", "petit", "ancien", "chemin", "musique", "cœur", "où"}, space: " ", comma: ",", stop: "."},
+	"ru": {words: []string{"и", "в", "дом", "дерево", "вода", "улица", "красивый", "город", "зелёный", "свет", "утро", "история", "сад", "окно", "тихий", "люди", "маленький", "старый", "дорога", "музыка"}, space: " ", comma: ",", stop: "."},
+	"el": {words: []string{"και", "το", "σπίτι", "δέντρο", "νερό", "δρόμος", "όμορφη", "πόλη", "πράσινο", "φως", "πρωί", "ιστορία", "κήπος", "παράθυρο", "ήσυχο", "άνθρωποι", "μικρό", "παλιό", "μουσική"}, space: " ", comma: ",", stop: "."},
+	"ar": {words: []string{"و", "في", "بيت", "شجرة", "ماء", "شارع", "جميل", "مدينة", "أخضر", "ضوء", "صباح", "قصة", "حديقة", "نافذة", "هادئ", "ناس", "صغير", "قديم", "طريق", "موسيقى"}, space: " ", comma: "،", stop: ".", rtl: true},
+	"hi": {words: []string{"और", "घर", "पेड़", "पानी", "सड़क", "सुंदर", "शहर", "हरा", "रोशनी", "सुबह", "कहानी", "बगीचा", "खिड़की", "शांत", "लोग", "छोटा", "पुराना", "रास्ता", "संगीत"}, space: " ", comma: ",", stop: "।"},
+	"ja": {words: []string{"私", "日本", "東京", "山", "川", "花", "猫", "空", "朝", "物語", "庭", "窓", "静か", "人々", "小さな", "古い", "道", "音楽", "の", "は", "が", "を"}, comma: "、", stop: "。"},
+	"zh": {words: []string{"我们", "城市", "山", "河", "花", "天空", "早上", "故事", "花园", "窗户", "安静", "人们", "小", "古老", "道路", "音乐", "的", "是", "在"}, comma: "，", stop: "。"},
+	"ko": {words: []string{"집", "나무", "물", "거리", "아름다운", "도시", "빛", "아침", "이야기", "정원", "창문", "조용한", "사람들", "작은", "오래된", "길", "음악"}, space: " ", comma: ",", stop: "."},
+}
+
+// languageCodes lists the keys of languages in a stable order, for mixed
+// documents to pick from deterministically.
+var languageCodes = []string{"ar", "de", "el", "en", "fr", "hi", "ja", "ko", "la", "ru", "zh"}
+
+type documentParams struct {
+	// Size of the document in bytes, takes precedence over paragraphs
+	Bytes int `query:"bytes"`
+	// The number of paragraphs, including headings and lists
+	Paragraphs int `query:"paragraphs" default:"5"`
+	// Language of the text, mixed uses a random language per paragraph
+	Lang string `query:"lang" default:"la" enums:"la,en,de,fr,ru,el,ar,hi,ja,zh,ko,mixed"`
+	// Nesting depth of the content, e.g. nested elements in HTML and XML
+	Depth int `query:"depth"`
+	// Size of a huge attribute on the root element
+	AttrSize int `query:"attr_size"`
+	// Seed of the random document
+	Seed int64 `query:"seed"`
+}
+
+// paragraph is a chunk of generated text with its language.
+type paragraph struct {
+	code string
+	lang *language
+	text string
+}
+
+type documentGenerator struct {
+	r    *rand.Rand
+	code string
+	dp   *documentParams
+}
+
+func (g *documentGenerator) language() (string, *language) {
+	code := g.code
+	if code == "mixed" {
+		code = languageCodes[g.r.Intn(len(languageCodes))]
+	}
+	return code, languages[code]
+}
+
+// documentLang returns the language tag of the whole document, mul for
+// multiple languages.
+func (g *documentGenerator) documentLang() string {
+	if g.code == "mixed" {
+		return "mul"
+	}
+	return g.code
+}
+
+func (g *documentGenerator) words(lang *language, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = lang.words[g.r.Intn(len(lang.words))]
+	}
+	return capitalize(strings.Join(words, lang.space))
+}
+
+func (g *documentGenerator) sentence(lang *language) string {
+	words := make([]string, 4+g.r.Intn(10))
+	for i := range words {
+		words[i] = lang.words[g.r.Intn(len(lang.words))]
+		if i > 0 && i < len(words)-1 && g.r.Intn(8) == 0 {
+			words[i] += lang.comma
+		}
+	}
+	return capitalize(strings.Join(words, lang.space)) + lang.stop
+}
+
+func (g *documentGenerator) paragraph() paragraph {
+	code, lang := g.language()
+	sentences := make([]string, 2+g.r.Intn(5))
+	for i := range sentences {
+		sentences[i] = g.sentence(lang)
+	}
+	return paragraph{code, lang, strings.Join(sentences, lang.space)}
+}
+
+func (g *documentGenerator) heading() paragraph {
+	code, lang := g.language()
+	return paragraph{code, lang, g.words(lang, 2+g.r.Intn(4))}
+}
+
+// filler returns n bytes of ASCII lorem ipsum.
+func filler(n int) string {
+	var sb strings.Builder
+	for i := 0; sb.Len() < n; i++ {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(fakeWords[i%len(fakeWords)])
+	}
+	return sb.String()[:n]
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// documentFormat renders generated paragraphs in a markup language. A
+// document consists of a head, blocks and a tail.
+type documentFormat struct {
+	contentType string
+	head        func(g *documentGenerator) string
+	block       func(g *documentGenerator, i int) string
+	tail        func(g *documentGenerator) string
+	// pad wraps filler text into a block
+	pad func(s string) string
+}
+
+func htmlLangAttrs(code string, lang *language) string {
+	attrs := fmt.Sprintf(` lang="%s"`, code)
+	if lang.rtl {
+		attrs += ` dir="rtl"`
+	}
+	return attrs
+}
+
+var documentFormats = map[string]*documentFormat{
+	"text": {
+		contentType: echo.MIMETextPlainCharsetUTF8,
+		head: func(g *documentGenerator) string {
+			return g.heading().text + "\n\n"
+		},
+		block: func(g *documentGenerator, i int) string {
+			return g.paragraph().text + "\n\n"
+		},
+		tail: func(g *documentGenerator) string { return "" },
+		pad:  func(s string) string { return s + "\n" },
+	},
+	"html": {
+		contentType: echo.MIMETextHTMLCharsetUTF8,
+		head: func(g *documentGenerator) string {
+			var sb strings.Builder
+			title := g.heading()
+			fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html lang=\"%s\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body", g.documentLang(), title.text)
+			if g.dp.AttrSize > 0 {
+				fmt.Fprintf(&sb, ` data-filler="%s"`, filler(g.dp.AttrSize))
+			}
+			sb.WriteString(">\n")
+			sb.WriteString(strings.Repeat("<div>", g.dp.Depth))
+			fmt.Fprintf(&sb, "<h1%s>%s</h1>\n", htmlLangAttrs(title.code, title.lang), title.text)
+			return sb.String()
+		},
+		block: func(g *documentGenerator, i int) string {
+			switch g.r.Intn(8) {
+			case 0:
+				h := g.heading()
+				return fmt.Sprintf("<h2%s>%s</h2>\n", htmlLangAttrs(h.code, h.lang), h.text)
+			case 1:
+				p := g.paragraph()
+				return fmt.Sprintf("<blockquote%s><p>%s</p></blockquote>\n", htmlLangAttrs(p.code, p.lang), p.text)
+			case 2:
+				var sb strings.Builder
+				sb.WriteString("<ul>\n")
+				for n := 2 + g.r.Intn(4); n > 0; n-- {
+					h := g.heading()
+					fmt.Fprintf(&sb, "<li%s>%s</li>\n", htmlLangAttrs(h.code, h.lang), h.text)
+				}
+				sb.WriteString("</ul>\n")
+				return sb.String()
+			default:
+				p := g.paragraph()
+				return fmt.Sprintf("<p%s>%s <a href=\"/links/10/%d\">%s</a></p>\n", htmlLangAttrs(p.code, p.lang), p.text, i%10, g.words(p.lang, 2))
+			}
+		},
+		tail: func(g *documentGenerator) string {
+			return strings.Repeat("</div>", g.dp.Depth) + "</body>\n</html>\n"
+		},
+		pad: func(s string) string { return "<p>" + s + "</p>\n" },
+	},
+	"markdown": {
+		contentType: "text/markdown; charset=UTF-8",
+		head: func(g *documentGenerator) string {
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "# %s\n\n", g.heading().text)
+			if g.dp.Depth > 0 {
+				// each > opens a nested block quote
+				fmt.Fprintf(&sb, "%s %s\n\n", strings.Repeat(">", g.dp.Depth), g.heading().text)
+			}
+			if g.dp.AttrSize > 0 {
+				fmt.Fprintf(&sb, "[%s](https://example.com/ \"%s\")\n\n", g.heading().text, filler(g.dp.AttrSize))
+			}
+			return sb.String()
+		},
+		block: func(g *documentGenerator, i int) string {
+			switch g.r.Intn(8) {
+			case 0:
+				return fmt.Sprintf("## %s\n\n", g.heading().text)
+			case 1:
+				return fmt.Sprintf("> %s\n\n", g.paragraph().text)
+			case 2:
+				var sb strings.Builder
+				for n := 2 + g.r.Intn(4); n > 0; n-- {
+					fmt.Fprintf(&sb, "- %s\n", g.heading().text)
+				}
+				sb.WriteString("\n")
+				return sb.String()
+			default:
+				p := g.paragraph()
+				return fmt.Sprintf("%s *%s* [%s](/links/10/%d)\n\n", p.text, g.words(p.lang, 2), g.words(p.lang, 2), i%10)
+			}
+		},
+		tail: func(g *documentGenerator) string { return "" },
+		pad:  func(s string) string { return s + "\n\n" },
+	},
+	"xml": {
+		contentType: echo.MIMEApplicationXMLCharsetUTF8,
+		head: func(g *documentGenerator) string {
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<document xml:lang=\"%s\"", g.documentLang())
+			if g.dp.AttrSize > 0 {
+				fmt.Fprintf(&sb, ` filler="%s"`, filler(g.dp.AttrSize))
+			}
+			fmt.Fprintf(&sb, ">\n<title>%s</title>\n", g.heading().text)
+			sb.WriteString(strings.Repeat("<section>", g.dp.Depth))
+			return sb.String()
+		},
+		block: func(g *documentGenerator, i int) string {
+			p := g.paragraph()
+			return fmt.Sprintf("<paragraph id=\"p%d\" xml:lang=\"%s\">%s</paragraph>\n", i+1, p.code, p.text)
+		},
+		tail: func(g *documentGenerator) string {
+			return strings.Repeat("</section>", g.dp.Depth) + "</document>\n"
+		},
+		pad: func(s string) string { return "<!-- " + s + " -->\n" },
+	},
+}
+
+// @Summary   Returns a random document of given size in text, HTML, Markdown or XML.
+// @Tags      Response formats
+// @Produce   plain
+// @Produce   html
+// @Produce   text/markdown
+// @Produce   xml
+// @Param     format      path   string  true   "Document format"  Enums(text, html, markdown, xml)
+// @Param     bytes       query  int     false  "Size of the document in bytes, takes precedence over paragraphs"
+// @Param     paragraphs  query  int     false  "The number of paragraphs, including headings and lists"            default(5)
+// @Param     lang        query  string  false  "Language of the text, mixed uses a random language per paragraph"  default(la)  Enums(la, en, de, fr, ru, el, ar, hi, ja, zh, ko, mixed)
+// @Param     depth       query  int     false  "Nesting depth of the content, e.g. nested elements in HTML and XML"
+// @Param     attr_size   query  int     false  "Size of a huge attribute on the root element"
+// @Param     seed        query  int     false  "Seed of the random document"
+// @Response  200         "A random document."
+// @Response  400         "Invalid parameters."
+// @Router    /generate/{format} [get]
+func generateDocumentHandler(c echo.Context) error {
+	format, ok := documentFormats[c.Param("format")]
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "unknown format")
+	}
+	dp := &documentParams{
+		Paragraphs: 5,
+		Lang:       "la",
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, dp); err != nil {
+		return err
+	}
+	if _, ok := languages[dp.Lang]; !ok && dp.Lang != "mixed" {
+		return echo.NewHTTPError(http.StatusBadRequest, "unknown language")
+	}
+	if dp.Bytes < 0 || dp.Paragraphs < 0 || dp.Depth < 0 || dp.AttrSize < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid parameters")
+	}
+	maxBytes := conf.Limits.MaxDocumentBytes
+	if dp.Bytes > maxBytes {
+		dp.Bytes = maxBytes
+	}
+	if dp.Depth > maxBytes || dp.AttrSize > maxBytes {
+		return echo.NewHTTPError(http.StatusBadRequest, "document too large")
+	}
+	r, err := getRand(c)
+	if err != nil {
+		return err
+	}
+	g := &documentGenerator{r: r, code: dp.Lang, dp: dp}
+
+	head, tail := format.head(g), format.tail(g)
+	size := len(head) + len(tail)
+	if size > maxBytes {
+		return echo.NewHTTPError(http.StatusBadRequest, "document too large")
+	}
+	var body strings.Builder
+	body.WriteString(head)
+	for i := 0; dp.Bytes > 0 || i < dp.Paragraphs; i++ {
+		block := format.block(g, i)
+		if size+len(block) > maxBytes || (dp.Bytes > 0 && size+len(block) > dp.Bytes) {
+			break
+		}
+		body.WriteString(block)
+		size += len(block)
+	}
+	// The rest of the requested size is filled up, so that the document is
+	// exactly as large as requested unless its head and tail are larger.
+	if rest := dp.Bytes - size; rest > 0 {
+		if overhead := len(format.pad("")); rest > overhead {
+			body.WriteString(format.pad(filler(rest - overhead)))
+		} else {
+			body.WriteString(strings.Repeat("\n", rest))
+		}
+	}
+	body.WriteString(tail)
+	return c.Blob(http.StatusOK, format.contentType, []byte(body.String()))
+}
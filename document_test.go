@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateDocumentHandler(t *testing.T) {
+	e := newEcho()
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+
+	cases := []struct {
+		format      string
+		contentType string
+	}{
+		{"text", "text/plain; charset=UTF-8"},
+		{"html", "text/html; charset=UTF-8"},
+		{"markdown", "text/markdown; charset=UTF-8"},
+		{"xml", "application/xml; charset=UTF-8"},
+	}
+	for _, v := range cases {
+		for _, size := range []int{300, 1000, 12345} {
+			res := get("/generate/" + v.format + "?lang=mixed&bytes=" + strconv.Itoa(size))
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, v.contentType, res.Header().Get("Content-Type"))
+			assert.Equal(t, size, res.Body.Len(), v.format)
+			assert.True(t, utf8.Valid(res.Body.Bytes()), v.format)
+		}
+
+		res1 := get("/generate/" + v.format + "?paragraphs=3&seed=1")
+		res2 := get("/generate/" + v.format + "?paragraphs=3&seed=1")
+		assert.Equal(t, res1.Body.String(), res2.Body.String())
+		assert.NotEqual(t, res1.Body.String(), get("/generate/"+v.format+"?paragraphs=3&seed=2").Body.String())
+	}
+
+	res := get("/generate/xml?paragraphs=4&lang=ja&depth=500&attr_size=10000")
+	assert.Equal(t, 500, strings.Count(res.Body.String(), "<section>"))
+	assert.Equal(t, 4, strings.Count(res.Body.String(), "<paragraph "))
+	assert.Contains(t, res.Body.String(), "。")
+	assert.NoError(t, checkWellFormedXML(res.Body.String()))
+
+	for _, format := range []string{"html", "xml"} {
+		assert.Contains(t, get("/generate/"+format+"?lang=mixed").Body.String(), `lang="mul"`, format)
+	}
+
+	res = get("/generate/html?depth=3&attr_size=20&lang=ar")
+	assert.Contains(t, res.Body.String(), `<body data-filler="lorem ipsum dolor si">`+"\n<div><div><div><h1")
+	assert.Contains(t, res.Body.String(), `dir="rtl"`)
+	assert.Contains(t, res.Body.String(), "</div></div></div></body>")
+
+	assert.Equal(t, http.StatusNotFound, get("/generate/pdf").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/generate/text?lang=xx").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/generate/text?depth=-1").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/generate/html?attr_size=2000000").Code)
+	assert.Equal(t, conf.Limits.MaxDocumentBytes, get("/generate/text?bytes=2000000").Body.Len())
+}
+
+func checkWellFormedXML(s string) error {
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// downloadLineLength is the length of the lines of download content. Each
+// line holds the version and offset of the line, like "v1 000000000016\n",
+// so that misplaced bytes of resumed downloads are easy to spot.
+const downloadLineLength = 16
+
+// downloadLastModified is the modification time of the first version of
+// downloads, later versions are a day newer each.
+var downloadLastModified = time.Date(2022, 2, 22, 0, 0, 0, 0, time.UTC)
+
+// writeDownload writes n bytes of download content from offset off, without
+// holding more than a chunk in memory.
+func writeDownload(c echo.Context, w io.Writer, version int, off, n int64) error {
+	buf := make([]byte, 0, 32<<10+downloadLineLength)
+	for n > 0 {
+		if err := pause(c, 0); err != nil {
+			return err
+		}
+		lineStart := off - off%downloadLineLength
+		buf = buf[:0]
+		for int64(len(buf)) < off-lineStart+n && len(buf) < 32<<10 {
+			buf = appendDownloadLine(buf, version, lineStart+int64(len(buf)))
+		}
+		chunk := buf[off-lineStart:]
+		if int64(len(chunk)) > n {
+			chunk = chunk[:n]
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		off += int64(len(chunk))
+		n -= int64(len(chunk))
+	}
+	return nil
+}
+
+func appendDownloadLine(buf []byte, version int, off int64) []byte {
+	buf = append(buf, 'v', byte('0'+version), ' ')
+	var scratch [20]byte
+	digits := strconv.AppendInt(scratch[:0], off, 10)
+	for i := len(digits); i < downloadLineLength-4; i++ {
+		buf = append(buf, '0')
+	}
+	return append(append(buf, digits...), '\n')
+}
+
+// parseSize parses sizes like 1024, 512k, 10M and 2G.
+func parseSize(s string) (int64, bool) {
+	multiplier := int64(1)
+	if s != "" {
+		switch strings.ToLower(s[len(s)-1:]) {
+		case "k":
+			multiplier = 1 << 10
+		case "m":
+			multiplier = 1 << 20
+		case "g":
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, ok := parseDigits(s)
+	if !ok || n > (1<<62)/multiplier {
+		return 0, false
+	}
+	return n * multiplier, true
+}
+
+type downloadParams struct {
+	// Ranges starting at or beyond this offset get another ETag and content, as if the file changed mid-download
+	ChangeETagAfter int64 `query:"change_etag_after"`
+}
+
+// @Summary   Downloads a large file of deterministic content, with support for ranges and resuming.
+// @Tags      Dynamic data
+// @Produce   octet-stream
+// @Param     size                 path    string  true   "Size of the file, e.g. 1048576, 512k, 10M or 2G"  default(1M)
+// @Param     change_etag_after    query   int     false  "Ranges starting at or beyond this offset get another ETag and content, as if the file changed mid-download"
+// @Param     Range                header  string  false  "Range"
+// @Param     If-Range             header  string  false  "If-Range"
+// @Param     If-Unmodified-Since  header  string  false  "If-Unmodified-Since"
+// @Param     If-Match             header  string  false  "If-Match"
+// @Param     If-None-Match        header  string  false  "If-None-Match"
+// @Param     If-Modified-Since    header  string  false  "If-Modified-Since"
+// @Response  200                  "The whole file."
+// @Response  206                  "The requested ranges, multiple ranges as multipart/byteranges."
+// @Response  304                  "Not modified."
+// @Response  412                  "A precondition of If-Match or If-Unmodified-Since failed."
+// @Response  416                  "None of the ranges can be satisfied."
+// @Router    /download/{size} [get]
+// @Router    /download/{size} [head]
+func downloadHandler(c echo.Context) error {
+	size, ok := parseSize(c.Param("size"))
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid size")
+	}
+	if size > conf.Limits.MaxDownloadBytes {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("size must not be greater than %d", conf.Limits.MaxDownloadBytes))
+	}
+	dp := &downloadParams{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, dp); err != nil {
+		return err
+	}
+	req := c.Request()
+	ranges, rangeErr := parseRange(req.Header.Get("Range"), size, conf.Limits.MaxRanges)
+
+	version := 1
+	if dp.ChangeETagAfter > 0 && len(ranges) > 0 && ranges[0].start >= dp.ChangeETagAfter {
+		version = 2
+	}
+	etag := fmt.Sprintf(`"download-%d-v%d"`, size, version)
+	lastModified := downloadLastModified.Add(time.Duration(version-1) * 24 * time.Hour)
+	h := c.Response().Header()
+	h.Set("ETag", etag)
+	h.Set(echo.HeaderLastModified, lastModified.Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	h.Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="download-%d.bin"`, size))
+
+	status, rangeOK := checkPreconditions(req, etag, lastModified)
+	if status != 0 {
+		return c.NoContent(status)
+	}
+	// Ranges are only served if the file is still the one the client has
+	if !rangeOK {
+		ranges, rangeErr = nil, nil
+	}
+	if rangeErr != nil {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		return c.NoContent(http.StatusRequestedRangeNotSatisfiable)
+	}
+	return serveRanges(c, echo.MIMEOctetStream, size, ranges, func(w io.Writer, off, n int64) error {
+		return writeDownload(c, w, version, off, n)
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadHandler(t *testing.T) {
+	e := newEcho()
+	do := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+
+	res := do(http.MethodGet, "/download/40", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "v1 000000000000\nv1 000000000016\nv1 00000", res.Body.String())
+	assert.Equal(t, "40", res.Header().Get("Content-Length"))
+	assert.Equal(t, `"download-40-v1"`, res.Header().Get("ETag"))
+	assert.Equal(t, "Tue, 22 Feb 2022 00:00:00 GMT", res.Header().Get("Last-Modified"))
+	assert.Equal(t, "bytes", res.Header().Get("Accept-Ranges"))
+
+	// content is the same regardless of how it is requested
+	res = do(http.MethodGet, "/download/100k", map[string]string{"Range": "bytes=40000-40019"})
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "bytes 40000-40019/102400", res.Header().Get("Content-Range"))
+	assert.Equal(t, "v1 000000040000\nv1 0", res.Body.String())
+	full := do(http.MethodGet, "/download/100k", nil).Body.String()
+	assert.Len(t, full, 100<<10)
+	assert.Equal(t, full[40000:40020], res.Body.String())
+
+	// sizes of gigabytes aren't generated for HEAD requests
+	res = do(http.MethodHead, "/download/4G", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "4294967296", res.Header().Get("Content-Length"))
+	assert.Empty(t, res.Body.String())
+	res = do(http.MethodGet, "/download/4G", map[string]string{"Range": "bytes=-10"})
+	assert.Equal(t, "4294967286-4294967295/4294967296", strings.TrimPrefix(res.Header().Get("Content-Range"), "bytes "))
+	assert.Equal(t, "v1 004294967280\n"[6:], res.Body.String())
+
+	// multiple ranges
+	res = do(http.MethodGet, "/download/100", map[string]string{"Range": "bytes=0-3, 20-23,-2"})
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	mediaType, params, err := mime.ParseMediaType(res.Header().Get("Content-Type"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "multipart/byteranges", mediaType)
+		assert.Equal(t, res.Header().Get("Content-Length"), strconv.Itoa(res.Body.Len()))
+		mr := multipart.NewReader(res.Body, params["boundary"])
+		expected := []struct{ contentRange, body string }{
+			{"bytes 0-3/100", "v1 0"},
+			{"bytes 20-23/100", "0000"},
+			{"bytes 98-99/100", " 0"},
+		}
+		for _, v := range expected {
+			part, err := mr.NextPart()
+			if !assert.NoError(t, err) {
+				break
+			}
+			assert.Equal(t, v.contentRange, part.Header.Get("Content-Range"))
+			assert.Equal(t, "application/octet-stream", part.Header.Get("Content-Type"))
+			body, _ := io.ReadAll(part)
+			assert.Equal(t, v.body, string(body))
+		}
+		_, err = mr.NextPart()
+		assert.Equal(t, io.EOF, err)
+	}
+
+	// If-Range
+	cases := []struct {
+		ifRange string
+		code    int
+	}{
+		{`"download-100-v1"`, http.StatusPartialContent},
+		{`W/"download-100-v1"`, http.StatusOK},
+		{`"download-100-v2"`, http.StatusOK},
+		{"Tue, 22 Feb 2022 00:00:00 GMT", http.StatusPartialContent},
+		{"Wed, 23 Feb 2022 00:00:00 GMT", http.StatusOK},
+	}
+	for _, v := range cases {
+		res = do(http.MethodGet, "/download/100", map[string]string{"Range": "bytes=10-", "If-Range": v.ifRange})
+		assert.Equal(t, v.code, res.Code, v.ifRange)
+	}
+
+	// If-Unmodified-Since
+	res = do(http.MethodGet, "/download/100", map[string]string{"If-Unmodified-Since": "Mon, 21 Feb 2022 00:00:00 GMT"})
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	res = do(http.MethodGet, "/download/100", map[string]string{"If-Unmodified-Since": "Tue, 22 Feb 2022 00:00:00 GMT"})
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	// If-None-Match
+	res = do(http.MethodGet, "/download/100", map[string]string{"If-None-Match": `"download-100-v1"`})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, `"download-100-v1"`, res.Header().Get("ETag"))
+	assert.Equal(t, "Tue, 22 Feb 2022 00:00:00 GMT", res.Header().Get("Last-Modified"))
+	assert.Empty(t, res.Body.String())
+	res = do(http.MethodGet, "/download/100", map[string]string{"If-Match": `"download-100-v2"`})
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+
+	// the file changes while resuming
+	res = do(http.MethodGet, "/download/100?change_etag_after=50", map[string]string{"Range": "bytes=0-49"})
+	assert.Equal(t, `"download-100-v1"`, res.Header().Get("ETag"))
+	res = do(http.MethodGet, "/download/100?change_etag_after=50", map[string]string{"Range": "bytes=50-", "If-Range": `"download-100-v1"`})
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"download-100-v2"`, res.Header().Get("ETag"))
+	assert.True(t, strings.HasPrefix(res.Body.String(), "v2 000000000000\n"))
+	res = do(http.MethodGet, "/download/100?change_etag_after=50", map[string]string{"Range": "bytes=50-", "If-Range": `"download-100-v2"`})
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+
+	res = do(http.MethodGet, "/download/100", map[string]string{"Range": "bytes=100-"})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.Code)
+	assert.Equal(t, "bytes */100", res.Header().Get("Content-Range"))
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, do(http.MethodGet, "/download/100", map[string]string{"Range": "bytes=5-1"}).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/download/100T", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/download/5G", nil).Code)
+}
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		s    string
+		size int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"1024", 1024, true},
+		{"512k", 512 << 10, true},
+		{"10M", 10 << 20, true},
+		{"2g", 2 << 30, true},
+		{"", 0, false},
+		{"k", 0, false},
+		{"-1", 0, false},
+		{"+1", 0, false},
+		{"1.5M", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+	for _, v := range cases {
+		size, ok := parseSize(v.s)
+		assert.Equal(t, v.size, size, v.s)
+		assert.Equal(t, v.ok, ok, v.s)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"math/rand"
 	"net/http"
@@ -20,9 +21,6 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-const maxByteCount = 100 << 10
-const maxDelay = 10 // seconds
-
 // @Summary  The request's query parameters.
 // @Tags     HTTP methods
 // @Produce  json
@@ -67,14 +65,24 @@ func otherMethodHandler(c echo.Context) error {
 	return c.JSONPretty(http.StatusOK, &res, "  ")
 }
 
-// @Summary  Returns the requester's IP Address.
+// @Summary  Returns the requester's IP Address and the forwarding chain.
 // @Tags     Request inspection
 // @Produce  json
 // @Success  200  {object}  requestIPResponse  "The Requester’s IP Address."
 // @Router   /ip [get]
 func requestIPHandler(c echo.Context) error {
+	header := c.Request().Header
+	peer := getPeer(c.Request())
 	return c.JSONPretty(http.StatusOK, &requestIPResponse{
-		Origin: getOrigin(c),
+		Origin:          getOrigin(c),
+		Peer:            peer,
+		Chain:           strings.Join(append(forwardedFor(c.Request()), peer), ", "),
+		Forwarded:       parseForwarded(header.Values("Forwarded")),
+		XForwardedFor:   splitHeaderList(header.Values(echo.HeaderXForwardedFor)),
+		XForwardedHost:  splitHeaderList(header.Values("X-Forwarded-Host")),
+		XForwardedProto: splitHeaderList(header.Values(echo.HeaderXForwardedProto)),
+		XForwardedPort:  splitHeaderList(header.Values("X-Forwarded-Port")),
+		XRealIP:         header.Get(echo.HeaderXRealIP),
 	}, "  ")
 }
 
@@ -105,7 +113,7 @@ type weightedCode struct {
 	code   int
 }
 
-func chooseStatusCode(weightedCodes []weightedCode) int {
+func chooseStatusCode(r *rand.Rand, weightedCodes []weightedCode) int {
 	var code int
 	var total float64
 	var cumWeights []float64
@@ -113,8 +121,7 @@ func chooseStatusCode(weightedCodes []weightedCode) int {
 		total += wc.weight
 		cumWeights = append(cumWeights, total)
 	}
-	rand.Seed(time.Now().UnixNano())
-	x := rand.Float64() * total
+	x := r.Float64() * total
 	for i, cumWeight := range cumWeights {
 		if cumWeight > x {
 			code = weightedCodes[i].code
@@ -124,28 +131,97 @@ func chooseStatusCode(weightedCodes []weightedCode) int {
 	return code
 }
 
-// @Summary   Return status code or random status code if more than one are given
+const mimeProblemJSON = "application/problem+json"
+
+type statusParams struct {
+	// Return an RFC 9457 application/problem+json body for 4xx and 5xx codes
+	Problem bool `query:"problem"`
+	// Value of the Retry-After header of 429 and 503 in seconds
+	RetryAfter int `query:"retry_after" default:"1"`
+}
+
+// writeStatus responds with code, along with the headers the code calls for.
+func writeStatus(c echo.Context, code int, p *statusParams) error {
+	if code < 100 || code > 999 {
+		return c.String(http.StatusBadRequest, "Invalid status code")
+	}
+	h := c.Response().Header()
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		location := c.Echo().URI(redirectHandler, 1)
+		if location == "" {
+			location = conf.Routes.BasePath + "/"
+		}
+		h.Set(echo.HeaderLocation, location)
+	case http.StatusUnauthorized:
+		h.Set(echo.HeaderWWWAuthenticate, `Basic realm="Fake Realm"`)
+	case http.StatusProxyAuthRequired:
+		h.Set("Proxy-Authenticate", `Basic realm="Fake Realm"`)
+	case http.StatusMethodNotAllowed:
+		var allow []string
+		for _, m := range []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			if m != c.Request().Method {
+				allow = append(allow, m)
+			}
+		}
+		h.Set(echo.HeaderAllow, strings.Join(allow, ", "))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// no range of an empty representation can be satisfied
+		h.Set("Content-Range", "bytes */0")
+	case http.StatusUpgradeRequired:
+		h.Set("Upgrade", "HTTP/3.0")
+		h.Set("Connection", "Upgrade")
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		h.Set(echo.HeaderRetryAfter, strconv.Itoa(p.RetryAfter))
+	}
+	if p.Problem && code >= 400 && code <= 599 {
+		b, _ := json.MarshalIndent(&problemResponse{
+			Type:     "about:blank",
+			Title:    http.StatusText(code),
+			Status:   code,
+			Detail:   fmt.Sprintf("%d returned as requested", code),
+			Instance: c.Request().RequestURI,
+		}, "", "  ")
+		return c.Blob(code, mimeProblemJSON, b)
+	}
+	return c.NoContent(code)
+}
+
+// @Summary   Return status code or random status code if more than one are given, with the headers the code calls for, like Location for redirects, WWW-Authenticate for 401, Allow for 405, Content-Range for 416 and Retry-After for 429 and 503.
 // @Tags      Status codes
 // @Produce   plain
-// @Param     codes  path  string  true  "codes"
-// @Response  100    "Informational responses"
-// @Response  200    "Success"
-// @Response  300    "Redirection"
-// @Response  400    "Client Errors"
-// @Response  500    "Server Errors"
+// @Produce   json
+// @Param     codes        path   string  true   "codes"
+// @Param     seed         query  int     false  "seed"
+// @Param     problem      query  bool    false  "Return an RFC 9457 application/problem+json body for 4xx and 5xx codes"
+// @Param     retry_after  query  int     false  "Value of the Retry-After header of 429 and 503 in seconds"  default(1)
+// @Response  100          "Informational responses"
+// @Response  200          "Success"
+// @Response  300          "Redirection"
+// @Response  400          "Client Errors"
+// @Response  500          "Server Errors"
 // @Router    /status/{codes} [delete]
 // @Router    /status/{codes} [get]
 // @Router    /status/{codes} [patch]
 // @Router    /status/{codes} [post]
 // @Router    /status/{codes} [put]
 func statusCodesHandler(c echo.Context) error {
+	p := &statusParams{
+		RetryAfter: 1,
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if p.RetryAfter < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "retry_after must not be negative")
+	}
 	codes, _ := url.PathUnescape(c.Param("codes"))
 	if !strings.Contains(codes, ",") {
 		code, err := strconv.Atoi(codes)
 		if err != nil {
 			return c.String(http.StatusBadRequest, "Invalid status code")
 		}
-		return c.NoContent(code)
+		return writeStatus(c, code, p)
 	}
 
 	var weightedCodes []weightedCode
@@ -168,7 +244,11 @@ func statusCodesHandler(c echo.Context) error {
 		}
 		weightedCodes = append(weightedCodes, weightedCode{weight, code})
 	}
-	return c.NoContent(chooseStatusCode(weightedCodes))
+	r, err := getRand(c)
+	if err != nil {
+		return err
+	}
+	return writeStatus(c, chooseStatusCode(r, weightedCodes), p)
 }
 
 //go:embed static/moby.html
@@ -326,27 +406,31 @@ func base64Handler(c echo.Context) error {
 // @Summary   Returns n random bytes generated with given seed
 // @Tags      Dynamic data
 // @Produce   octet-stream
-// @Param     n     path   int  true   "number of bytes"
-// @Param     seed  query  int  false  "seed"
-// @Response  200   "Bytes."
+// @Param     n               path   int     true   "number of bytes"
+// @Param     seed            query  int     false  "seed"
+// @Param     truncate        query  int     false  "Truncate the body at given number of bytes"
+// @Param     flip_bits       query  int     false  "The number of random bits to flip, at most the number of bits of the body"
+// @Param     magic           query  string  false  "Overwrite the start of the body with the magic bytes of another format"  Enums(png, jpeg, gif, webp, pdf, zip, gzip, elf)
+// @Param     content_type    query  string  false  "Content-Type to declare instead of the real one"
+// @Param     content_length  query  int     false  "Content-Length to declare regardless of the actual length, only works with HTTP/1.x"
+// @Response  200             "Bytes."
 // @Router    /bytes/{n} [get]
 func generateBytesHandler(c echo.Context) error {
 	n := c.Param("n")
-	seed := c.QueryParam("seed")
 	intN, err := strconv.Atoi(n)
 	if err != nil || intN < 0 {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid number of bytes")
 	}
-	if intN > maxByteCount {
-		intN = maxByteCount
+	if intN > conf.Limits.MaxBytes {
+		intN = conf.Limits.MaxBytes
 	}
-	seedInt, err := strconv.Atoi(seed)
-	if err == nil {
-		rand.Seed(int64(seedInt))
+	r, err := getRand(c)
+	if err != nil {
+		return err
 	}
 	bytes := make([]byte, intN)
-	rand.Read(bytes)
-	return c.Blob(http.StatusOK, echo.MIMEOctetStream, bytes)
+	r.Read(bytes)
+	return writeMedia(c, echo.MIMEOctetStream, bytes, r)
 }
 
 // @Summary   Returns a delayed response (max of 10 seconds).
@@ -365,10 +449,12 @@ func delayHandler(c echo.Context) error {
 	if err != nil || intDelay < 0 {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid number of delay")
 	}
-	if intDelay > maxDelay {
-		intDelay = maxDelay
+	if intDelay > conf.Limits.MaxDelay {
+		intDelay = conf.Limits.MaxDelay
+	}
+	if err := pause(c, time.Duration(intDelay)*time.Second); err != nil {
+		return err
 	}
-	time.Sleep(time.Duration(intDelay) * time.Second)
 	data := ""
 	files := getFiles(c)
 	form := getForm(c)
@@ -400,7 +486,8 @@ type dripParams struct {
 // @Summary   Drips data over a duration after an optional initial delay.
 // @Tags      Dynamic data
 // @Produce   octet-stream
-// @Param     dripParams  query  dripParams  true  "dripParams"
+// @Param     dripParams  query  dripParams  true   "dripParams"
+// @Param     seed        query  int         false  "Drip random bytes generated with given seed instead of asterisks"
 // @Response  200         "A dripped response."
 // @Router    /drip [get]
 func dripHandler(c echo.Context) error {
@@ -416,23 +503,40 @@ func dripHandler(c echo.Context) error {
 
 	if dp.Delay < 0 {
 		dp.Delay = 0
-	} else if dp.Delay > 10 {
-		dp.Delay = 10
+	} else if dp.Delay > float64(conf.Limits.MaxDelay) {
+		dp.Delay = float64(conf.Limits.MaxDelay)
 	}
 
 	if dp.Duration < 0.1 {
 		dp.Duration = 0.1 // Minimum duration = 100 Millisecond
-	} else if dp.Duration > 60 {
-		dp.Duration = 60
+	} else if dp.Duration > float64(conf.Limits.MaxDuration) {
+		dp.Duration = float64(conf.Limits.MaxDuration)
 	}
 
 	if dp.Numbytes < 0 {
 		dp.Numbytes = 0
-	} else if dp.Numbytes > 10<<20 {
-		dp.Numbytes = 10 << 20 // Millisecond
+	} else if dp.Numbytes > conf.Limits.MaxDripBytes {
+		dp.Numbytes = conf.Limits.MaxDripBytes
+	}
+
+	drip := func(n int) []byte {
+		return bytes.Repeat([]byte{'*'}, n)
+	}
+	if c.QueryParams().Has("seed") {
+		r, err := getRand(c)
+		if err != nil {
+			return err
+		}
+		drip = func(n int) []byte {
+			b := make([]byte, n)
+			r.Read(b)
+			return b
+		}
 	}
 
-	time.Sleep(time.Duration(dp.Delay*1000) * time.Millisecond)
+	if err := pause(c, time.Duration(dp.Delay*1000)*time.Millisecond); err != nil {
+		return err
+	}
 
 	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
 	c.Response().Header().Set(echo.HeaderContentLength, strconv.Itoa(dp.Numbytes))
@@ -445,13 +549,15 @@ func dripHandler(c echo.Context) error {
 		chunkLength = dp.Numbytes/times + 1
 	}
 	if chunkLength == 1 {
-		pause := int(dp.Duration*1000) / remainBytes
+		pausePerByte := int(dp.Duration*1000) / remainBytes
 		for remainBytes > 0 {
-			if _, err := c.Response().Write([]byte{'*'}); err != nil {
+			if _, err := c.Response().Write(drip(1)); err != nil {
 				return err
 			}
 			c.Response().Flush()
-			time.Sleep(time.Duration(pause) * time.Millisecond)
+			if err := pause(c, time.Duration(pausePerByte)*time.Millisecond); err != nil {
+				return err
+			}
 			remainBytes--
 		}
 	} else {
@@ -462,11 +568,13 @@ func dripHandler(c echo.Context) error {
 			} else {
 				length = remainBytes
 			}
-			if _, err := c.Response().Write(bytes.Repeat([]byte{'*'}, length)); err != nil {
+			if _, err := c.Response().Write(drip(length)); err != nil {
 				return err
 			}
 			c.Response().Flush()
-			time.Sleep(100 * time.Millisecond)
+			if err := pause(c, 100*time.Millisecond); err != nil {
+				return err
+			}
 			remainBytes -= length
 		}
 	}
@@ -503,8 +611,8 @@ func linksHandler(c echo.Context) error {
 
 	if lp.N < 1 {
 		lp.N = 1 // Minimum 1
-	} else if lp.N > 200 {
-		lp.N = 200 // Maximum 200
+	} else if lp.N > conf.Limits.MaxLinks {
+		lp.N = conf.Limits.MaxLinks
 	}
 
 	t := template.Must(template.New("links").Parse(linksTemplate))
@@ -532,10 +640,13 @@ type rangeParams struct {
 // @Summary   Streams n random bytes generated with given seed, at given chunk size per packet.
 // @Tags      Dynamic data
 // @Produce   octet-stream
-// @Param     numbytes    path   int     true   "The amount of bytes"  default(10)
-// @Param     chunk_size  query  int     false  "chunk_size"
-// @Param     duration    query  number  false  "duration"
+// @Param     numbytes    path    int     true   "The amount of bytes"  default(10)
+// @Param     chunk_size  query   int     false  "chunk_size"
+// @Param     duration    query   number  false  "duration"
+// @Param     Range       header  string  false  "Range"
 // @Response  200         "Bytes"
+// @Response  206         "The requested ranges, multiple ranges as multipart/byteranges."
+// @Response  416         "Invalid, unsatisfiable or too many ranges."
 // @Router    /range/{numbytes} [get]
 func rangeHandler(c echo.Context) error {
 	rp := &rangeParams{
@@ -544,66 +655,62 @@ func rangeHandler(c echo.Context) error {
 	if err := c.Bind(rp); err != nil {
 		return err
 	}
-	if rp.Numbytes <= 0 || rp.Numbytes > maxByteCount {
+	if rp.Numbytes <= 0 || rp.Numbytes > conf.Limits.MaxBytes {
 		c.Response().Header().Set("ETag", fmt.Sprintf("range%d", rp.Numbytes))
 		c.Response().Header().Set("Accept-Ranges", "bytes")
-		return echo.NewHTTPError(http.StatusNotFound, "number of bytes must be in the range (0, 102400]")
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("number of bytes must be in the range (0, %d]", conf.Limits.MaxBytes))
 	}
 	if rp.ChunkSize < 1 {
 		rp.ChunkSize = 1
 	}
 	if rp.Duration < 0 {
 		rp.Duration = 0
-	} else if rp.Duration > 60 {
-		rp.Duration = 60
+	} else if rp.Duration > float64(conf.Limits.MaxDuration) {
+		rp.Duration = float64(conf.Limits.MaxDuration)
 	}
-	first, last := getRequestRange(c.Request().Header.Get("Range"), rp.Numbytes)
-	if first > last || last >= rp.Numbytes {
-		c.Response().Header().Set("ETag", fmt.Sprintf("range%d", rp.Numbytes))
+	size := int64(rp.Numbytes)
+	ranges, err := parseRange(c.Request().Header.Get("Range"), size, conf.Limits.MaxRanges)
+	c.Response().Header().Set("ETag", fmt.Sprintf("range%d", rp.Numbytes))
+	if err != nil {
 		c.Response().Header().Set("Accept-Ranges", "bytes")
 		c.Response().Header().Set("Content-Range", fmt.Sprintf("bytes */%d", rp.Numbytes))
 		c.Response().Header().Set(echo.HeaderContentLength, "0")
 		return c.NoContent(http.StatusRequestedRangeNotSatisfiable)
 	}
 
-	contentRange := fmt.Sprintf("bytes %d-%d/%d", first, last, rp.Numbytes)
-	contentLength := fmt.Sprintf("%d", last-first+1)
-	code := http.StatusPartialContent
-	if first == 0 && last == rp.Numbytes-1 {
-		code = http.StatusOK
-	}
-	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
-	c.Response().Header().Set("ETag", fmt.Sprintf("range%d", rp.Numbytes))
-	c.Response().Header().Set("Accept-Ranges", "bytes")
-	c.Response().Header().Set(echo.HeaderContentLength, contentLength)
-	c.Response().Header().Set("Content-Range", contentRange)
-	c.Response().WriteHeader(code)
-
-	pausePerByte := rp.Duration * 1000 / float64(last-first+1) // Millisecond
-	cursor := first
-	for cursor <= last {
-		chunk := rp.ChunkSize
-		if chunk >= last-cursor {
-			chunk = last - cursor + 1
-		}
-		pause := pausePerByte * float64(chunk)
-		time.Sleep(time.Duration(pause) * time.Millisecond)
-		bytes := make([]byte, chunk)
-		for i := cursor; i < cursor+chunk; i++ {
-			bytes[i-cursor] = byte('a' + i%26)
+	total := size
+	if len(ranges) > 0 {
+		total = 0
+		for _, r := range ranges {
+			total += r.length
 		}
-		if _, err := c.Response().Write(bytes); err != nil {
-			return err
-		}
-		c.Response().Flush()
-		cursor += chunk
 	}
-	return nil
+	pausePerByte := rp.Duration * 1000 / float64(total) // Millisecond
+	return serveRanges(c, echo.MIMEOctetStream, size, ranges, func(w io.Writer, off, n int64) error {
+		for cursor, last := off, off+n-1; cursor <= last; {
+			chunk := int64(rp.ChunkSize)
+			if chunk >= last-cursor {
+				chunk = last - cursor + 1
+			}
+			if err := pause(c, time.Duration(pausePerByte*float64(chunk))*time.Millisecond); err != nil {
+				return err
+			}
+			bytes := make([]byte, chunk)
+			for i := cursor; i < cursor+chunk; i++ {
+				bytes[i-cursor] = byte('a' + i%26)
+			}
+			if _, err := w.Write(bytes); err != nil {
+				return err
+			}
+			c.Response().Flush()
+			cursor += chunk
+		}
+		return nil
+	})
 }
 
 type streamBytesParams struct {
 	N         int `param:"n"`
-	Seed      int `query:"seed"`
 	ChunkSize int `query:"chunk_size"`
 }
 
@@ -623,26 +730,30 @@ func streamBytesHandler(c echo.Context) error {
 		return err
 	}
 
-	if sbp.N > maxByteCount {
-		sbp.N = maxByteCount
+	if sbp.N > conf.Limits.MaxBytes {
+		sbp.N = conf.Limits.MaxBytes
 	}
 	if sbp.ChunkSize < 1 {
 		sbp.ChunkSize = 1
 	}
-	if c.QueryParams().Has("seed") {
-		rand.Seed(int64(sbp.Seed))
+	r, err := getRand(c)
+	if err != nil {
+		return err
 	}
 
 	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
 	c.Response().WriteHeader(http.StatusOK)
 	remainBytes := sbp.N
 	for remainBytes > 0 {
+		if err := pause(c, 0); err != nil {
+			return err
+		}
 		chunk := sbp.ChunkSize
 		if sbp.ChunkSize > remainBytes {
 			chunk = remainBytes
 		}
 		bytes := make([]byte, chunk)
-		rand.Read(bytes)
+		r.Read(bytes)
 		if _, err := c.Response().Write(bytes); err != nil {
 			return err
 		}
@@ -664,8 +775,8 @@ func streamHandler(c echo.Context) error {
 	if err != nil || intN < 0 {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid number of JSON objects")
 	}
-	if intN > 100 {
-		intN = 100
+	if intN > conf.Limits.MaxStream {
+		intN = conf.Limits.MaxStream
 	}
 
 	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -679,6 +790,9 @@ func streamHandler(c echo.Context) error {
 	}
 	enc := json.NewEncoder(c.Response())
 	for i := 0; i < intN; i++ {
+		if err := pause(c, 0); err != nil {
+			return err
+		}
 		res.ID = i
 		if err := enc.Encode(res); err != nil {
 			return err
@@ -691,10 +805,22 @@ func streamHandler(c echo.Context) error {
 // @Summary   Return a UUID4.
 // @Tags      Dynamic data
 // @Produce   json
-// @Response  200  "A UUID4."
+// @Param     seed  query  int  false  "seed"
+// @Response  200   "A UUID4."
 // @Router    /uuid [get]
 func UUIDHandler(c echo.Context) error {
-	uuid, err := uuid.NewRandom()
+	// UUIDs are only predictable when asked for with a seed
+	newUUID := uuid.NewRandom
+	if c.QueryParams().Has("seed") {
+		r, err := getRand(c)
+		if err != nil {
+			return err
+		}
+		newUUID = func() (uuid.UUID, error) {
+			return uuid.NewRandomFromReader(r)
+		}
+	}
+	uuid, err := newUUID()
 	if err != nil {
 		return err
 	}
@@ -742,47 +868,69 @@ func imageHandler(c echo.Context) error {
 // @Summary   Returns a simple WEBP image.
 // @Tags      Images
 // @Produce   image/webp
-// @Response  200  "A WEBP image."
+// @Param     truncate        query  int     false  "Truncate the body at given number of bytes"
+// @Param     flip_bits       query  int     false  "The number of random bits to flip, at most the number of bits of the body"
+// @Param     magic           query  string  false  "Overwrite the start of the body with the magic bytes of another format"  Enums(png, jpeg, gif, webp, pdf, zip, gzip, elf)
+// @Param     content_type    query  string  false  "Content-Type to declare instead of the real one"
+// @Param     content_length  query  int     false  "Content-Length to declare regardless of the actual length, only works with HTTP/1.x"
+// @Response  200             "A WEBP image."
 // @Router    /image/webp [get]
 func imageWebPHandler(c echo.Context) error {
-	return c.Blob(http.StatusOK, "image/webp", sampleWebP)
+	return writeMedia(c, "image/webp", sampleWebP, nil)
 }
 
 // @Summary   Returns a simple SVG image.
 // @Tags      Images
 // @Produce   image/svg+xml
-// @Response  200  "An SVG image."
+// @Param     truncate        query  int     false  "Truncate the body at given number of bytes"
+// @Param     flip_bits       query  int     false  "The number of random bits to flip, at most the number of bits of the body"
+// @Param     magic           query  string  false  "Overwrite the start of the body with the magic bytes of another format"  Enums(png, jpeg, gif, webp, pdf, zip, gzip, elf)
+// @Param     content_type    query  string  false  "Content-Type to declare instead of the real one"
+// @Param     content_length  query  int     false  "Content-Length to declare regardless of the actual length, only works with HTTP/1.x"
+// @Response  200             "An SVG image."
 // @Router    /image/svg [get]
 func imageSVGHandler(c echo.Context) error {
-	return c.Blob(http.StatusOK, "image/svg+xml", sampleSVG)
+	return writeMedia(c, "image/svg+xml", sampleSVG, nil)
 }
 
 // @Summary   Returns a simple JPEG image.
 // @Tags      Images
 // @Produce   image/jpeg
-// @Response  200  "A JPEG image."
+// @Param     truncate        query  int     false  "Truncate the body at given number of bytes"
+// @Param     flip_bits       query  int     false  "The number of random bits to flip, at most the number of bits of the body"
+// @Param     magic           query  string  false  "Overwrite the start of the body with the magic bytes of another format"  Enums(png, jpeg, gif, webp, pdf, zip, gzip, elf)
+// @Param     content_type    query  string  false  "Content-Type to declare instead of the real one"
+// @Param     content_length  query  int     false  "Content-Length to declare regardless of the actual length, only works with HTTP/1.x"
+// @Response  200             "A JPEG image."
 // @Router    /image/jpeg [get]
 func imageJPEGHandler(c echo.Context) error {
-	return c.Blob(http.StatusOK, "image/jpeg", sampleJPEG)
+	return writeMedia(c, "image/jpeg", sampleJPEG, nil)
 }
 
 // @Summary   Returns a simple PNG image.
 // @Tags      Images
 // @Produce   image/png
-// @Response  200  "A PNG image."
+// @Param     truncate        query  int     false  "Truncate the body at given number of bytes"
+// @Param     flip_bits       query  int     false  "The number of random bits to flip, at most the number of bits of the body"
+// @Param     magic           query  string  false  "Overwrite the start of the body with the magic bytes of another format"  Enums(png, jpeg, gif, webp, pdf, zip, gzip, elf)
+// @Param     content_type    query  string  false  "Content-Type to declare instead of the real one"
+// @Param     content_length  query  int     false  "Content-Length to declare regardless of the actual length, only works with HTTP/1.x"
+// @Response  200             "A PNG image."
 // @Router    /image/png [get]
 func imagePNGHandler(c echo.Context) error {
-	return c.Blob(http.StatusOK, "image/png", samplePNG)
+	return writeMedia(c, "image/png", samplePNG, nil)
 }
 
-// @Summary   Returns cookie data.
-// @Tags      Cookies
-// @Produce   json
-// @Response  200  "Cookies"
-// @Router    /cookies [get]
+// @Summary  Returns cookie data, and the Cookie header as received.
+// @Tags     Cookies
+// @Produce  json
+// @Success  200  {object}  cookiesResponse
+// @Router   /cookies [get]
 func getCookiesHandler(c echo.Context) error {
 	return c.JSONPretty(http.StatusOK, &cookiesResponse{
 		Cookies: getCookies(c),
+		// HTTP/2 clients may send each cookie in a header of its own
+		Header: strings.Join(c.Request().Header.Values("Cookie"), "; "),
 	}, "  ")
 }
 
@@ -888,25 +1036,38 @@ func otherRedirectToHandler(c echo.Context) error {
 	return redirectToHandler(c)
 }
 
+// nextRedirect returns the URI a redirect chain of n times, with n as the
+// path param, continues with. Chains go on with h, and end with /get.
+func nextRedirect(c echo.Context, h echo.HandlerFunc, absolute bool) (uri string, last bool, err error) {
+	n := c.Param("n")
+	intN, err := strconv.Atoi(n)
+	if err != nil || intN < 0 {
+		return "", false, echo.NewHTTPError(http.StatusBadRequest, "invalid number of redirection times")
+	}
+	if intN == 1 {
+		uri, last = c.Echo().URI(getMethodHandler), true
+		if uri == "" {
+			// the HTTP methods routes may be disabled
+			uri = conf.Routes.BasePath + "/"
+		}
+	} else {
+		uri = c.Echo().URI(h, strconv.Itoa(intN-1))
+	}
+	if absolute {
+		uri = c.Scheme() + "://" + c.Request().Host + uri
+	}
+	return uri, last, nil
+}
+
 func redirect(absolute bool) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		n := c.Param("n")
-		intN, err := strconv.Atoi(n)
-		if err != nil || intN < 0 {
-			return echo.NewHTTPError(http.StatusBadRequest, "invalid number of redirection times")
-		}
-		var redirectURI string
-		if intN == 1 {
-			redirectURI = c.Echo().URI(getMethodHandler)
-		} else {
-			h := relativeRedirectHandler
-			if absolute {
-				h = absoluteRedirectHandler
-			}
-			redirectURI = c.Echo().URI(h, strconv.Itoa(intN-1))
-		}
+		h := relativeRedirectHandler
 		if absolute {
-			redirectURI = c.Scheme() + "://" + c.Request().Host + redirectURI
+			h = absoluteRedirectHandler
+		}
+		redirectURI, _, err := nextRedirect(c, h, absolute)
+		if err != nil {
+			return err
 		}
 		return c.Redirect(http.StatusFound, redirectURI)
 	}
@@ -962,13 +1123,17 @@ func absoluteRedirectHandler(c echo.Context) error {
 // @Router    /anything/{anything} [post]
 // @Router    /anything/{anything} [put]
 func anythingHandler(c echo.Context) error {
+	return c.JSONPretty(http.StatusOK, getAnything(c), "  ")
+}
+
+func getAnything(c echo.Context) *anythingResponse {
 	data := ""
 	files := getFiles(c)
 	form := getForm(c)
 	if len(files) == 0 && len(form) == 0 {
 		data = getData(c)
 	}
-	res := anythingResponse{}
+	res := &anythingResponse{}
 	res.Args = getArgs(c)
 	res.Data = data
 	res.Files = files
@@ -978,28 +1143,35 @@ func anythingHandler(c echo.Context) error {
 	res.Origin = getOrigin(c)
 	res.URL = getURL(c)
 	res.Method = c.Request().Method
-	return c.JSONPretty(http.StatusOK, &res, "  ")
+	res.Trailers = getTrailers(c)
+	return res
 }
 
-// @Summary   Returns a 304 if an If-Modified-Since header or If-None-Match is present. Returns the same as a GET otherwise.
+// cacheETag and cacheLastModified are the validators of /cache, which stay the
+// same while the server is running.
+var (
+	cacheETag         = strconv.Quote(strings.ReplaceAll(uuid.NewString(), "-", ""))
+	cacheLastModified = time.Now().UTC().Truncate(time.Second)
+)
+
+// @Summary   Returns a 304 if the If-Modified-Since or If-None-Match headers match the validators of the response, which don't change while the server is running. Returns the same as a GET otherwise.
 // @Tags      Response inspection
 // @Produce   json
-// @Response  200                "Normal response"
-// @Response  304                "Not modified"
-// @Param     If-Modified-Since  header  string  false  "If-Modified-Since"
-// @Param     If-None-Match      header  string  false  "If-None-Match"
+// @Response  200                  "Normal response"
+// @Response  304                  "Not modified"
+// @Response  412                  "Precondition failed"
+// @Param     If-Modified-Since    header  string  false  "If-Modified-Since"
+// @Param     If-None-Match        header  string  false  "If-None-Match"
+// @Param     If-Match             header  string  false  "If-Match"
+// @Param     If-Unmodified-Since  header  string  false  "If-Unmodified-Since"
 // @Router    /cache [get]
 func cacheHandler(c echo.Context) error {
-	header := c.Request().Header
-	if header.Get(echo.HeaderIfModifiedSince) == "" && header.Get("If-None-Match") == "" {
-		etag := uuid.New()
-		c.Response().Header().Set(echo.HeaderLastModified, time.Now().UTC().Format(http.TimeFormat))
-		c.Response().Header().Set("ETag", fmt.Sprintf("%x", etag[:]))
-		return getMethodHandler(c)
-	}
-	// TODO: seems we need to return etag in header as well.
-	// see also: https://www.ietf.org/rfc/rfc2616.txt
-	return c.NoContent(http.StatusNotModified)
+	c.Response().Header().Set(echo.HeaderLastModified, cacheLastModified.Format(http.TimeFormat))
+	c.Response().Header().Set("ETag", cacheETag)
+	if status, _ := checkPreconditions(c.Request(), cacheETag, cacheLastModified); status != 0 {
+		return c.NoContent(status)
+	}
+	return getMethodHandler(c)
 }
 
 // @Summary   Sets a Cache-Control header for n seconds.
@@ -1014,35 +1186,45 @@ func cacheDurationHandler(c echo.Context) error {
 	if err != nil || maxAge < 0 {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid number of seconds")
 	}
-	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	cc := newCacheControlParams(maxAge)
+	cc.Visibility = "public"
+	c.Response().Header().Set("Cache-Control", cc.String())
 	return getMethodHandler(c)
 }
 
+type etagParams struct {
+	// Whether the etag is weak
+	Weak bool `query:"weak"`
+}
+
 // @Summary   Assumes the resource has the given etag and responds to If-None-Match and If-Match headers appropriately.
 // @Tags      Response inspection
 // @Produce   json
 // @Response  200            "Normal response"
 // @Response  304            "Not modified"
 // @Response  412            "Precondition failed"
-// @Param     etag           path    string  true   "etag"
-// @Param     If-Match       header  string  false  "If-Match"
-// @Param     If-None-Match  header  string  false  "If-None-Match"
+// @Param     etag           path    string      true   "etag, quoted if it isn't already"
+// @Param     etagParams     query   etagParams  false  "etagParams"
+// @Param     If-Match       header  string      false  "If-Match"
+// @Param     If-None-Match  header  string      false  "If-None-Match"
 // @Router    /etag/{etag} [get]
 func etagHandler(c echo.Context) error {
-	etag := c.Param("etag")
-	ifNoneMatch := c.Request().Header.Get("If-None-Match")
-	ifMatch := c.Request().Header.Get("If-Match")
-	if ifNoneMatch != "" {
-		if strings.Contains(ifNoneMatch, etag) || strings.Contains(ifNoneMatch, "*") {
-			c.Response().Header().Set("ETag", etag)
-			return c.NoContent(http.StatusNotModified)
-		}
-	} else if ifMatch != "" {
-		if !strings.Contains(ifMatch, etag) && !strings.Contains(ifMatch, "*") {
-			return c.NoContent(http.StatusPreconditionFailed)
+	ep := &etagParams{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, ep); err != nil {
+		return err
+	}
+	t, rest, ok := parseETag(c.Param("etag"))
+	if !ok || rest != "" {
+		if t, rest, ok = parseETag(strconv.Quote(c.Param("etag"))); !ok || rest != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid etag")
 		}
 	}
+	t.weak = t.weak || ep.Weak
+	etag := t.String()
 	c.Response().Header().Set("ETag", etag)
+	if status, _ := checkPreconditions(c.Request(), etag, time.Time{}); status != 0 {
+		return c.NoContent(status)
+	}
 	return getMethodHandler(c)
 }
 
@@ -1120,7 +1302,7 @@ var swaggerUIFiles embed.FS
 
 func swaggerUIHandler(c echo.Context) error {
 	swaggerUIRoot, _ := fs.Sub(swaggerUIFiles, "static/swagger-ui")
-	assetHandler := http.FileServer(http.FS(swaggerUIRoot))
+	assetHandler := http.StripPrefix(conf.Routes.BasePath, http.FileServer(http.FS(swaggerUIRoot)))
 	return echo.WrapHandler(assetHandler)(c)
 }
 
@@ -1137,6 +1319,34 @@ func swaggerDocHandler(c echo.Context) error {
 		doc["schemes"] = []string{"http", "https"}
 	}
 	docInfo["version"] = fmt.Sprintf("%s-%s", version, revision)
+	if conf.Routes.BasePath != "" {
+		doc["basePath"] = conf.Routes.BasePath
+	}
+	// Hide operations and tags of disabled route groups
+	paths, _ := doc["paths"].(map[string]interface{})
+	for path, p := range paths {
+		operations, _ := p.(map[string]interface{})
+		for method, op := range operations {
+			tags, _ := op.(map[string]interface{})["tags"].([]interface{})
+			for _, tag := range tags {
+				if name, _ := tag.(string); !conf.Routes.enabled(name) {
+					delete(operations, method)
+					break
+				}
+			}
+		}
+		if len(operations) == 0 {
+			delete(paths, path)
+		}
+	}
+	tags := []interface{}{}
+	docTags, _ := doc["tags"].([]interface{})
+	for _, tag := range docTags {
+		if name, _ := tag.(map[string]interface{})["name"].(string); conf.Routes.enabled(name) {
+			tags = append(tags, tag)
+		}
+	}
+	doc["tags"] = tags
 	return c.JSON(http.StatusOK, doc)
 }
 
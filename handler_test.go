@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -190,11 +191,64 @@ func TestStatusCodesHandler(t *testing.T) {
 	}
 }
 
+func TestStatusCodesHeaders(t *testing.T) {
+	e := newEcho()
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(method, target, nil))
+		return res
+	}
+
+	cases := []struct {
+		target string
+		header string
+		value  string
+	}{
+		{"/status/302", echo.HeaderLocation, "/redirect/1"},
+		{"/status/308", echo.HeaderLocation, "/redirect/1"},
+		{"/status/401", echo.HeaderWWWAuthenticate, `Basic realm="Fake Realm"`},
+		{"/status/407", "Proxy-Authenticate", `Basic realm="Fake Realm"`},
+		{"/status/405", echo.HeaderAllow, "HEAD, POST, PUT, PATCH, DELETE"},
+		{"/status/416", "Content-Range", "bytes */0"},
+		{"/status/426", "Upgrade", "HTTP/3.0"},
+		{"/status/429", echo.HeaderRetryAfter, "1"},
+		{"/status/503?retry_after=120", echo.HeaderRetryAfter, "120"},
+	}
+	for _, v := range cases {
+		res := serve(http.MethodGet, v.target)
+		assert.Equal(t, v.value, res.Header().Get(v.header), v.target)
+		assert.Empty(t, res.Body.String(), v.target)
+	}
+	assert.Empty(t, serve(http.MethodGet, "/status/304").Header().Get(echo.HeaderLocation))
+
+	res := serve(http.MethodPost, "/status/404?problem=true")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, mimeProblemJSON, res.Header().Get(echo.HeaderContentType))
+	pr := problemResponse{}
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &pr)) {
+		assert.Equal(t, problemResponse{
+			Type:     "about:blank",
+			Title:    "Not Found",
+			Status:   404,
+			Detail:   "404 returned as requested",
+			Instance: "/status/404?problem=true",
+		}, pr)
+	}
+	res = serve(http.MethodGet, "/status/200?problem=true")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/status/42").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/status/503?retry_after=-1").Code)
+}
+
 func TestRequestIPHandler(t *testing.T) {
 	e := newEcho()
 
 	expected := `{
-  "origin": "192.0.2.1"
+  "origin": "192.0.2.1",
+  "peer": "192.0.2.1",
+  "chain": "192.0.2.1"
 }`
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	res := httptest.NewRecorder()
@@ -203,6 +257,62 @@ func TestRequestIPHandler(t *testing.T) {
 		assert.Equal(t, http.StatusOK, res.Code)
 		assert.Equal(t, expected+"\n", res.Body.String())
 	}
+
+	// Forwarding headers from an untrusted peer are reported but not used
+	expected = `{
+  "origin": "192.0.2.1",
+  "peer": "192.0.2.1",
+  "chain": "203.0.113.1, 198.51.100.1, 192.0.2.1",
+  "x-forwarded-for": [
+    "203.0.113.1",
+    "198.51.100.1"
+  ],
+  "x-forwarded-proto": [
+    "https"
+  ]
+}`
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.1, 198.51.100.1")
+	req.Header.Set(echo.HeaderXForwardedProto, "https")
+	res = httptest.NewRecorder()
+	c = e.NewContext(req, res)
+	if assert.NoError(t, requestIPHandler(c)) {
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, expected+"\n", res.Body.String())
+	}
+
+	// Forwarded takes precedence over X-Forwarded-For
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Proxy.Trusted = []string{"192.0.2.0/24", "198.51.100.0/24"}
+	e = newEcho()
+	expected = `{
+  "origin": "2001:db8:cafe::17",
+  "peer": "192.0.2.1",
+  "chain": "[2001:db8:cafe::17]:4711, 198.51.100.1, 192.0.2.1",
+  "forwarded": [
+    {
+      "for": "[2001:db8:cafe::17]:4711",
+      "proto": "https"
+    },
+    {
+      "for": "198.51.100.1",
+      "by": "192.0.2.1"
+    }
+  ],
+  "x-forwarded-for": [
+    "203.0.113.1"
+  ]
+}`
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Forwarded", `for="[2001:db8:cafe::17]:4711";proto=https, for=198.51.100.1;by=192.0.2.1`)
+	req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.1")
+	res = httptest.NewRecorder()
+	c = e.NewContext(req, res)
+	if assert.NoError(t, requestIPHandler(c)) {
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, expected+"\n", res.Body.String())
+	}
 }
 
 func TestRequestHeadersHandler(t *testing.T) {
@@ -528,6 +638,8 @@ func TestUUIDHandler(t *testing.T) {
 			assert.Error(t, err)
 		}
 		assert.NotEmpty(t, ur)
+		// crypto/rand is used without a seed
+		assert.Empty(t, res.Header().Get("X-Echobin-Seed"))
 	}
 }
 
@@ -577,10 +689,13 @@ func TestGetCookiesHandler(t *testing.T) {
 	}
 	expectedJSON := `{
   "cookies": {
-    "hello": "world"
-  }
+    "hello": "world",
+    "konnichiwa": "sekai"
+  },
+  "header": "hello=world; konnichiwa=sekai"
 }`
 	req.AddCookie(cookie)
+	req.AddCookie(&http.Cookie{Name: "konnichiwa", Value: "sekai"})
 	res := httptest.NewRecorder()
 	c := e.NewContext(req, res)
 	if assert.NoError(t, getCookiesHandler(c)) {
@@ -779,24 +894,35 @@ func TestCacheHandler(t *testing.T) {
 	if assert.NoError(t, cacheHandler(c)) {
 		assert.Equal(t, http.StatusOK, res.Code)
 		assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, res.Header().Get(echo.HeaderContentType))
-		assert.Contains(t, res.Header(), echo.HeaderLastModified)
-		assert.Contains(t, res.Header(), "Etag")
+		assert.Equal(t, cacheLastModified.Format(http.TimeFormat), res.Header().Get(echo.HeaderLastModified))
+		assert.Equal(t, cacheETag, res.Header().Get("ETag"))
 	}
 
-	cachedCases := []struct {
+	cases := []struct {
 		header string
 		value  string
+		code   int
 	}{
-		{echo.HeaderIfModifiedSince, time.Now().UTC().Format(http.TimeFormat)},
-		{"If-None-Match", "772867218dd444f6b15f1d9eb67f74bd"},
+		{echo.HeaderIfModifiedSince, time.Now().UTC().Format(http.TimeFormat), http.StatusNotModified},
+		{echo.HeaderIfModifiedSince, cacheLastModified.Add(-time.Second).Format(http.TimeFormat), http.StatusOK},
+		{echo.HeaderIfModifiedSince, "yesterday", http.StatusOK},
+		{"If-None-Match", cacheETag, http.StatusNotModified},
+		{"If-None-Match", `"772867218dd444f6b15f1d9eb67f74bd", W/` + cacheETag, http.StatusNotModified},
+		{"If-None-Match", "*", http.StatusNotModified},
+		{"If-None-Match", `"772867218dd444f6b15f1d9eb67f74bd"`, http.StatusOK},
+		{"If-Match", "W/" + cacheETag, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since", cacheLastModified.Add(-time.Second).Format(http.TimeFormat), http.StatusPreconditionFailed},
 	}
-	for _, v := range cachedCases {
+	for _, v := range cases {
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
 		req.Header.Set(v.header, v.value)
 		res := httptest.NewRecorder()
 		c := e.NewContext(req, res)
 		if assert.NoError(t, cacheHandler(c)) {
-			assert.Equal(t, http.StatusNotModified, res.Code)
+			assert.Equal(t, v.code, res.Code, v)
+			// validators are sent with 304 responses too
+			assert.Equal(t, cacheETag, res.Header().Get("ETag"))
+			assert.Equal(t, cacheLastModified.Format(http.TimeFormat), res.Header().Get(echo.HeaderLastModified))
 		}
 	}
 }
@@ -819,59 +945,56 @@ func TestCacheDurationHandler(t *testing.T) {
 func TestEtagHandler(t *testing.T) {
 	e := newEcho()
 
-	// No headers
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	res := httptest.NewRecorder()
-	c := e.NewContext(req, res)
-	c.SetParamNames("etag")
-	c.SetParamValues("abcdef")
-	if assert.NoError(t, etagHandler(c)) {
-		assert.Equal(t, http.StatusOK, res.Code)
-		assert.Equal(t, "abcdef", res.Header().Get("ETag"))
-	}
-
-	// Test If-None-Match header
-	req = httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set("If-None-Match", "abcdef") // Match, return 304
-	res = httptest.NewRecorder()
-	c = e.NewContext(req, res)
-	c.SetParamNames("etag")
-	c.SetParamValues("abcdef")
-	if assert.NoError(t, etagHandler(c)) {
-		assert.Equal(t, http.StatusNotModified, res.Code)
-		assert.Equal(t, "abcdef", res.Header().Get("ETag"))
+	cases := []struct {
+		etag    string
+		target  string
+		headers map[string]string
+		code    int
+		header  string
+	}{
+		// No headers
+		{"abcdef", "/", nil, http.StatusOK, `"abcdef"`},
+		{`"abcdef"`, "/", nil, http.StatusOK, `"abcdef"`},
+		{`W/"abcdef"`, "/", nil, http.StatusOK, `W/"abcdef"`},
+		{"abcdef", "/?weak=true", nil, http.StatusOK, `W/"abcdef"`},
+		// If-None-Match uses weak comparison
+		{"abcdef", "/", map[string]string{"If-None-Match": `"abcdef"`}, http.StatusNotModified, `"abcdef"`},
+		{"abcdef", "/?weak=true", map[string]string{"If-None-Match": `"fedcba", "abcdef"`}, http.StatusNotModified, `W/"abcdef"`},
+		{"abcdef", "/", map[string]string{"If-None-Match": `W/"abcdef"`}, http.StatusNotModified, `"abcdef"`},
+		{"abcdef", "/", map[string]string{"If-None-Match": "*"}, http.StatusNotModified, `"abcdef"`},
+		{"abcdef", "/", map[string]string{"If-None-Match": `"fedcba"`}, http.StatusOK, `"abcdef"`},
+		{"abcd", "/", map[string]string{"If-None-Match": `"abcdef"`}, http.StatusOK, `"abcd"`},
+		{"abcdef", "/", map[string]string{"If-None-Match": "abcdef"}, http.StatusOK, `"abcdef"`},
+		// If-Match uses strong comparison
+		{"abcdef", "/", map[string]string{"If-Match": `"abcdef"`}, http.StatusOK, `"abcdef"`},
+		{"abcdef", "/", map[string]string{"If-Match": `"fedcba"`}, http.StatusPreconditionFailed, `"abcdef"`},
+		{"abcdef", "/", map[string]string{"If-Match": `W/"abcdef"`}, http.StatusPreconditionFailed, `"abcdef"`},
+		{"abcdef", "/?weak=true", map[string]string{"If-Match": `"abcdef"`}, http.StatusPreconditionFailed, `W/"abcdef"`},
+		{"abcdef", "/?weak=true", map[string]string{"If-Match": "*"}, http.StatusOK, `W/"abcdef"`},
+		// If-Match is evaluated first
+		{"abcdef", "/", map[string]string{"If-Match": `"fedcba"`, "If-None-Match": `"fedcba"`}, http.StatusPreconditionFailed, `"abcdef"`},
 	}
-	req = httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set("If-None-Match", "fedcba") // Not match, return normal response
-	res = httptest.NewRecorder()
-	c = e.NewContext(req, res)
-	c.SetParamNames("etag")
-	c.SetParamValues("abcdef")
-	if assert.NoError(t, etagHandler(c)) {
-		assert.Equal(t, http.StatusOK, res.Code)
-		assert.Equal(t, "abcdef", res.Header().Get("ETag"))
+	for _, v := range cases {
+		req := httptest.NewRequest(http.MethodGet, v.target, nil)
+		for k, value := range v.headers {
+			req.Header.Set(k, value)
+		}
+		res := httptest.NewRecorder()
+		c := e.NewContext(req, res)
+		c.SetParamNames("etag")
+		c.SetParamValues(v.etag)
+		if assert.NoError(t, etagHandler(c)) {
+			assert.Equal(t, v.code, res.Code, v)
+			assert.Equal(t, v.header, res.Header().Get("ETag"), v)
+		}
 	}
 
-	// Test If-Match header
-	req = httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set("If-Match", "abcdef") // Match, return normal response
-	res = httptest.NewRecorder()
-	c = e.NewContext(req, res)
-	c.SetParamNames("etag")
-	c.SetParamValues("abcdef")
-	if assert.NoError(t, etagHandler(c)) {
-		assert.Equal(t, http.StatusOK, res.Code)
-		assert.Equal(t, "abcdef", res.Header().Get("ETag"))
-	}
-	req = httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set("If-Match", "fedcba") // Not match, return 412
-	res = httptest.NewRecorder()
-	c = e.NewContext(req, res)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
 	c.SetParamNames("etag")
-	c.SetParamValues("abcdef")
-	if assert.NoError(t, etagHandler(c)) {
-		assert.Equal(t, http.StatusPreconditionFailed, res.Code)
-	}
+	c.SetParamValues("a b")
+	assert.Error(t, etagHandler(c))
 }
 
 func TestResponseHeadersHandler(t *testing.T) {
@@ -983,8 +1106,9 @@ func TestRangeHandler(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, res.Code)
 
 	badHeaders := []string{
-		"bytes=100-1",     // start is greater than end
-		"bytes=100-10000", // end is greater than maximum
+		"bytes=100-1",  // start is greater than end
+		"bytes=10000-", // start is greater than maximum
+		"bytes=" + strings.Repeat("0-0,", 51),
 	}
 	for _, bh := range badHeaders {
 		req := httptest.NewRequest(http.MethodGet, "/range/10000", nil)
@@ -992,8 +1116,18 @@ func TestRangeHandler(t *testing.T) {
 		res := httptest.NewRecorder()
 		e.ServeHTTP(res, req)
 		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.Code)
+		assert.Equal(t, "bytes */10000", res.Header().Get("Content-Range"))
 	}
 
+	// end is greater than maximum
+	req = httptest.NewRequest(http.MethodGet, "/range/10000", nil)
+	req.Header.Set("Range", "bytes=100-10000")
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "bytes 100-9999/10000", res.Header().Get("Content-Range"))
+	assert.Len(t, res.Body.Bytes(), 9900)
+
 	reqFull := httptest.NewRequest(http.MethodGet, "/range/10000", nil)
 	reqFull.Header.Set("Range", "bytes=0-9999")
 	resFull := httptest.NewRecorder()
@@ -1024,6 +1158,25 @@ func TestRangeHandler(t *testing.T) {
 		assert.Equal(t, fmt.Sprintf("bytes %d-%d/10000", v.start, v.end), res.Result().Header.Get("Content-Range"))
 		assert.Len(t, res.Body.Bytes(), v.end-v.start+1)
 	}
+
+	req = httptest.NewRequest(http.MethodGet, "/range/100?chunk_size=3", nil)
+	req.Header.Set("Range", "bytes=0-1,26-27,-1")
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	_, params, err := mime.ParseMediaType(res.Header().Get(echo.HeaderContentType))
+	assert.NoError(t, err)
+	assert.EqualValues(t, res.Body.Len(), res.Result().ContentLength)
+	mr := multipart.NewReader(res.Body, params["boundary"])
+	for _, expected := range [][2]string{{"bytes 0-1/100", "ab"}, {"bytes 26-27/100", "ab"}, {"bytes 99-99/100", "v"}} {
+		part, err := mr.NextPart()
+		if !assert.NoError(t, err) {
+			break
+		}
+		body, _ := io.ReadAll(part)
+		assert.Equal(t, expected[0], part.Header.Get("Content-Range"))
+		assert.Equal(t, expected[1], string(body))
+	}
 }
 
 func TestFormHandler(t *testing.T) {
@@ -1038,3 +1191,96 @@ func TestFormHandler(t *testing.T) {
 		assert.Equal(t, echo.MIMETextHTMLCharsetUTF8, res.Header().Get(echo.HeaderContentType))
 	}
 }
+
+func TestSwaggerDocHandler(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Routes.BasePath = "/echobin"
+	conf.Routes.Disabled = []string{"Cookies"}
+	e := newEcho()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	res := httptest.NewRecorder()
+	c := e.NewContext(req, res)
+	if assert.NoError(t, swaggerDocHandler(c)) {
+		assert.Equal(t, http.StatusOK, res.Code)
+		var doc struct {
+			BasePath string                 `json:"basePath"`
+			Paths    map[string]interface{} `json:"paths"`
+			Tags     []struct {
+				Name string `json:"name"`
+			} `json:"tags"`
+		}
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &doc))
+		assert.Equal(t, "/echobin", doc.BasePath)
+		assert.Contains(t, doc.Paths, "/get")
+		assert.NotContains(t, doc.Paths, "/cookies")
+		for _, tag := range doc.Tags {
+			assert.NotEqual(t, "Cookies", tag.Name)
+		}
+	}
+}
+
+func TestSeededHandlers(t *testing.T) {
+	e := newEcho()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+	targets := []string{
+		"/bytes/100",
+		"/stream-bytes/100?chunk_size=7",
+		"/uuid",
+		"/drip?duration=0.1&numbytes=5&delay=0",
+		"/status/200,201,202,203,204,205,206",
+	}
+	for _, target := range targets {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		// Requests of different seeds are run concurrently to make sure they
+		// don't share a random source.
+		results := make(chan [2]*httptest.ResponseRecorder, 20)
+		for i := 0; i < cap(results); i++ {
+			go func(i int) {
+				res1 := get(fmt.Sprintf("%s%sseed=%d", target, sep, i%2))
+				res2 := get(fmt.Sprintf("%s%sseed=%d", target, sep, i%2))
+				results <- [2]*httptest.ResponseRecorder{res1, res2}
+			}(i)
+		}
+		for i := 0; i < cap(results); i++ {
+			res := <-results
+			assert.Equal(t, res[0].Code, res[1].Code, target)
+			assert.Equal(t, res[0].Body.Bytes(), res[1].Body.Bytes(), target)
+			assert.Equal(t, res[0].Header().Get("X-Echobin-Seed"), res[1].Header().Get("X-Echobin-Seed"), target)
+		}
+		if !strings.HasPrefix(target, "/status/") {
+			assert.NotEqual(t, get(target+sep+"seed=1").Body.Bytes(), get(target+sep+"seed=2").Body.Bytes(), target)
+		}
+
+		// the effective seed replays a response
+		res := get(target)
+		seed := res.Header().Get("X-Echobin-Seed")
+		// unless seeded, UUIDs use crypto/rand and drips are asterisks
+		switch target {
+		case "/uuid":
+			assert.Empty(t, seed)
+			assert.Equal(t, http.StatusBadRequest, get(target+sep+"seed=abc").Code, target)
+			continue
+		case "/drip?duration=0.1&numbytes=5&delay=0":
+			assert.Empty(t, seed)
+			assert.Equal(t, "*****", res.Body.String())
+			continue
+		}
+		assert.NotEmpty(t, seed, target)
+		replayed := get(target + sep + "seed=" + seed)
+		assert.Equal(t, res.Code, replayed.Code, target)
+		assert.Equal(t, res.Body.Bytes(), replayed.Body.Bytes(), target)
+
+		assert.Equal(t, http.StatusBadRequest, get(target+sep+"seed=abc").Code, target)
+	}
+}
@@ -3,14 +3,24 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
 	"net/url"
-	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
+const headerXEchobinSeed = "X-Echobin-Seed"
+
 func getURL(c echo.Context) string {
 	r := c.Request()
 	fullURL := c.Scheme() + "://" + r.Host + r.URL.Path
@@ -37,6 +47,18 @@ func getHeaders(c echo.Context) map[string]string {
 	return headers
 }
 
+// getTrailers returns the trailers of the request, which are only known once
+// the body has been read.
+func getTrailers(c echo.Context) map[string]string {
+	trailers := map[string]string{}
+	for k, v := range c.Request().Trailer {
+		if len(v) > 0 {
+			trailers[k] = v[0]
+		}
+	}
+	return trailers
+}
+
 func getArgs(c echo.Context) map[string]interface{} {
 	args := map[string]interface{}{}
 	for k, v := range c.QueryParams() {
@@ -118,31 +140,362 @@ func basicAuthValidator(user, passwd string, c echo.Context) (bool, error) {
 	return false, nil
 }
 
-func getRequestRange(rawRange string, length int) (start, end int) {
-	re := regexp.MustCompile(`^bytes=(\d*)-(\d*)$`)
-	match := re.FindStringSubmatch(rawRange)
-	if match != nil {
-		left, right := match[1], match[2]
-		if left == "" && right == "" {
-			return 0, length - 1
-		} else if left == "" {
-			// suppose length = 10000, then -500 means last 500 bytes
-			// which range from 9500 - 9999
-			// see also: https://datatracker.ietf.org/doc/html/rfc7233#section-2.1
-			first := 0
-			i, _ := strconv.Atoi(right)
-			if length-i > 0 {
-				first = length - i
+// getRand returns a random number generator of the request, seeded with the
+// seed query parameter or the current time. The effective seed is sent back
+// in the X-Echobin-Seed header so that responses can be replayed.
+func getRand(c echo.Context) (*rand.Rand, error) {
+	seed := time.Now().UnixNano()
+	if s := c.QueryParam("seed"); s != "" {
+		var err error
+		seed, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid seed")
+		}
+	}
+	c.Response().Header().Set(headerXEchobinSeed, strconv.FormatInt(seed, 10))
+	return rand.New(rand.NewSource(seed)), nil
+}
+
+var (
+	errInvalidRange       = errors.New("invalid range")
+	errUnsatisfiableRange = errors.New("range not satisfiable")
+	errTooManyRanges      = errors.New("too many ranges")
+)
+
+// httpRange is a byte range of a representation requested with the Range
+// header.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) end() int64 {
+	return r.start + r.length
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end()-1, size)
+}
+
+// parseRange parses the Range header for a representation of given size.
+// Empty headers and units other than bytes return no ranges, as they are
+// ignored. errUnsatisfiableRange is returned if none of the ranges overlaps
+// the representation, and errTooManyRanges if there are more than maxRanges.
+// Overlapping and adjacent ranges are coalesced.
+// see also: https://datatracker.ietf.org/doc/html/rfc9110#section-14.2
+func parseRange(header string, size int64, maxRanges int) ([]httpRange, error) {
+	parts := strings.SplitN(header, "=", 2)
+	if len(parts) != 2 || !strings.EqualFold(strings.TrimSpace(parts[0]), "bytes") {
+		return nil, nil
+	}
+	var ranges []httpRange
+	specs := 0
+	for _, spec := range strings.Split(parts[1], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			// empty list elements are allowed
+			continue
+		}
+		if specs++; specs > maxRanges {
+			return nil, errTooManyRanges
+		}
+		bounds := strings.SplitN(spec, "-", 2)
+		if len(bounds) != 2 {
+			return nil, errInvalidRange
+		}
+		first, last := strings.TrimSpace(bounds[0]), strings.TrimSpace(bounds[1])
+		if first == "" {
+			// suffix range, e.g. -500 for the last 500 bytes
+			n, ok := parseDigits(last)
+			if !ok {
+				return nil, errInvalidRange
+			}
+			if n > size {
+				n = size
+			}
+			if n > 0 {
+				ranges = append(ranges, httpRange{size - n, n})
+			}
+			continue
+		}
+		start, ok := parseDigits(first)
+		if !ok {
+			return nil, errInvalidRange
+		}
+		end := size - 1
+		if last != "" {
+			if end, ok = parseDigits(last); !ok || end < start {
+				return nil, errInvalidRange
 			}
-			return first, length - 1
-		} else if right == "" {
-			first, _ := strconv.Atoi(left)
-			return first, length - 1
+		}
+		if start >= size {
+			continue
+		}
+		if end >= size {
+			end = size - 1
+		}
+		ranges = append(ranges, httpRange{start, end - start + 1})
+	}
+	if specs == 0 {
+		return nil, nil
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return coalesceRanges(ranges), nil
+}
+
+// coalesceRanges merges overlapping and adjacent ranges into ascending
+// order. Ranges which don't need to be merged are kept in the requested order.
+func coalesceRanges(ranges []httpRange) []httpRange {
+	sorted := append([]httpRange{}, ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	merged := sorted[:1]
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.start > last.end() {
+			merged = append(merged, r)
+		} else if r.end() > last.end() {
+			last.length = r.end() - last.start
+		}
+	}
+	if len(merged) == len(ranges) {
+		return ranges
+	}
+	return merged
+}
+
+// parseDigits parses non-negative integers, which unlike strconv.ParseInt
+// doesn't accept signs.
+func parseDigits(s string) (int64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// serveRanges writes the requested ranges of a representation of given size,
+// as a single part or as multipart/byteranges. The content of each range is
+// written by content. All of the representation is sent without ranges.
+func serveRanges(c echo.Context, contentType string, size int64, ranges []httpRange, content func(w io.Writer, off, n int64) error) error {
+	h := c.Response().Header()
+	h.Set("Accept-Ranges", "bytes")
+	bodyless := c.Request().Method == http.MethodHead
+	switch len(ranges) {
+	case 0:
+		h.Set(echo.HeaderContentType, contentType)
+		h.Set(echo.HeaderContentLength, strconv.FormatInt(size, 10))
+		c.Response().WriteHeader(http.StatusOK)
+		if bodyless {
+			return nil
+		}
+		return content(c.Response(), 0, size)
+	case 1:
+		h.Set(echo.HeaderContentType, contentType)
+		h.Set(echo.HeaderContentLength, strconv.FormatInt(ranges[0].length, 10))
+		h.Set("Content-Range", ranges[0].contentRange(size))
+		if ranges[0].length == size {
+			c.Response().WriteHeader(http.StatusOK)
 		} else {
-			first, _ := strconv.Atoi(left)
-			last, _ := strconv.Atoi(right)
-			return first, last
+			c.Response().WriteHeader(http.StatusPartialContent)
+		}
+		if bodyless {
+			return nil
+		}
+		return content(c.Response(), ranges[0].start, ranges[0].length)
+	}
+
+	// The parts are written like mime/multipart does, but by hand to know
+	// the length of the body in advance.
+	boundary := multipart.NewWriter(nil).Boundary()
+	partHeaders := make([]string, len(ranges))
+	length := int64(len("\r\n--" + boundary + "--\r\n"))
+	for i, r := range ranges {
+		partHeaders[i] = fmt.Sprintf("\r\n--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n", boundary, contentType, r.contentRange(size))
+		if i == 0 {
+			partHeaders[i] = partHeaders[i][2:]
+		}
+		length += int64(len(partHeaders[i])) + r.length
+	}
+	h.Set(echo.HeaderContentType, "multipart/byteranges; boundary="+boundary)
+	h.Set(echo.HeaderContentLength, strconv.FormatInt(length, 10))
+	c.Response().WriteHeader(http.StatusPartialContent)
+	if bodyless {
+		return nil
+	}
+	for i, r := range ranges {
+		if _, err := io.WriteString(c.Response(), partHeaders[i]); err != nil {
+			return err
+		}
+		if err := content(c.Response(), r.start, r.length); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(c.Response(), "\r\n--"+boundary+"--\r\n")
+	return err
+}
+
+// entityTag is an entity tag like "xyzzy" or W/"xyzzy". The opaque tag is
+// kept with its quotes.
+type entityTag struct {
+	opaque string
+	weak   bool
+}
+
+func (t entityTag) String() string {
+	if t.weak {
+		return "W/" + t.opaque
+	}
+	return t.opaque
+}
+
+// strongMatch reports whether both tags are strong and have the same opaque
+// tag, as required by If-Match and If-Range.
+func (t entityTag) strongMatch(o entityTag) bool {
+	return !t.weak && !o.weak && t.opaque == o.opaque
+}
+
+// weakMatch reports whether both tags have the same opaque tag, regardless of
+// being weak or not, as required by If-None-Match.
+func (t entityTag) weakMatch(o entityTag) bool {
+	return t.opaque == o.opaque
+}
+
+// parseETag parses the entity tag at the start of s, and returns the rest of s.
+// see also: https://datatracker.ietf.org/doc/html/rfc9110#section-8.8.3
+func parseETag(s string) (entityTag, string, bool) {
+	t := entityTag{}
+	if strings.HasPrefix(s, "W/") {
+		t.weak = true
+		s = s[2:]
+	}
+	if !strings.HasPrefix(s, `"`) {
+		return entityTag{}, s, false
+	}
+	for i := 1; i < len(s); i++ {
+		switch b := s[i]; {
+		case b == '"':
+			t.opaque = s[:i+1]
+			return t, s[i+1:], true
+		case b == 0x21, b >= 0x23 && b != 0x7f:
+		default:
+			return entityTag{}, s, false
+		}
+	}
+	return entityTag{}, s, false
+}
+
+// parseETagList parses the value of If-Match and If-None-Match headers, which
+// is either "*" or a list of entity tags. ok is false for invalid values.
+func parseETagList(header string) (tags []entityTag, wildcard bool, ok bool) {
+	s := strings.TrimSpace(header)
+	if s == "*" {
+		return nil, true, true
+	}
+	for s != "" {
+		if s[0] == ',' {
+			// empty list elements are allowed
+			s = strings.TrimLeft(s[1:], " \t")
+			continue
+		}
+		t, rest, ok := parseETag(s)
+		if !ok {
+			return nil, false, false
+		}
+		tags = append(tags, t)
+		s = strings.TrimLeft(rest, " \t")
+		if s != "" && s[0] != ',' {
+			return nil, false, false
 		}
 	}
-	return 0, length - 1
+	return tags, false, len(tags) > 0
+}
+
+// matchETags reports whether any of the entity tags in the header values
+// matches current. Invalid values never match.
+func matchETags(values []string, current *entityTag, strong bool) bool {
+	tags, wildcard, ok := parseETagList(strings.Join(values, ","))
+	if !ok {
+		return false
+	}
+	if wildcard {
+		return true
+	}
+	if current == nil {
+		return false
+	}
+	for _, t := range tags {
+		if strong && t.strongMatch(*current) || !strong && t.weakMatch(*current) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHTTPDate parses the value of date headers like If-Modified-Since.
+// Headers with multiple values are invalid.
+func parseHTTPDate(values []string) (time.Time, bool) {
+	if len(values) != 1 {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(strings.TrimSpace(values[0]))
+	return t, err == nil
+}
+
+// checkPreconditions evaluates the conditional headers of a request for a
+// representation with given entity tag and modification time, in the order
+// defined by RFC 9110. An empty etag or a zero lastModified means that the
+// validator isn't available. It returns the status to respond with instead,
+// 304 or 412, or 0 to carry on, and whether the Range header may be served
+// according to If-Range.
+// The headers of the normal response should be set before, as 304 responses
+// must have the ETag, Last-Modified, Cache-Control, Expires and Vary headers
+// that a 200 response would have.
+// see also: https://datatracker.ietf.org/doc/html/rfc9110#section-13.2.2
+func checkPreconditions(r *http.Request, etag string, lastModified time.Time) (int, bool) {
+	var current *entityTag
+	if t, rest, ok := parseETag(etag); ok && rest == "" {
+		current = &t
+	}
+	lastModified = lastModified.Truncate(time.Second)
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if values := r.Header.Values("If-Match"); len(values) > 0 {
+		if !matchETags(values, current, true) {
+			return http.StatusPreconditionFailed, false
+		}
+	} else if since, ok := parseHTTPDate(r.Header.Values("If-Unmodified-Since")); ok && !lastModified.IsZero() {
+		if lastModified.After(since) {
+			return http.StatusPreconditionFailed, false
+		}
+	}
+
+	if values := r.Header.Values("If-None-Match"); len(values) > 0 {
+		if matchETags(values, current, false) {
+			if safe {
+				return http.StatusNotModified, false
+			}
+			return http.StatusPreconditionFailed, false
+		}
+	} else if since, ok := parseHTTPDate(r.Header.Values(echo.HeaderIfModifiedSince)); ok && safe && !lastModified.IsZero() {
+		if !lastModified.After(since) {
+			return http.StatusNotModified, false
+		}
+	}
+
+	ifRange := strings.TrimSpace(r.Header.Get("If-Range"))
+	if ifRange == "" || r.Header.Get("Range") == "" {
+		return 0, true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		t, rest, ok := parseETag(ifRange)
+		return 0, ok && rest == "" && current != nil && t.strongMatch(*current)
+	}
+	since, err := http.ParseTime(ifRange)
+	return 0, err == nil && !lastModified.IsZero() && since.Equal(lastModified)
 }
@@ -1,27 +1,141 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetRequestRange(t *testing.T) {
+func TestParseRange(t *testing.T) {
 	cases := []struct {
 		rawRange string
-		length   int
-		start    int
-		end      int
+		ranges   []httpRange
+		err      error
 	}{
-		{"unknownUnit=0-500", 10000, 0, 9999},
-		{"bytes=", 10000, 0, 9999},
-		{"bytes=0-500", 10000, 0, 500},
-		{"bytes=500-", 10000, 500, 9999},
-		{"bytes=-500", 10000, 9500, 9999},
+		{"", nil, nil},
+		{"unknownUnit=0-500", nil, nil},
+		{"bytes=", nil, nil},
+		{"bytes=0-500", []httpRange{{0, 501}}, nil},
+		{"BYTES = 0-500", []httpRange{{0, 501}}, nil},
+		{"bytes=500-", []httpRange{{500, 9500}}, nil},
+		{"bytes=-500", []httpRange{{9500, 500}}, nil},
+		{"bytes=-20000", []httpRange{{0, 10000}}, nil},
+		{"bytes=9000-20000", []httpRange{{9000, 1000}}, nil},
+		{"bytes=0-1,5-9", []httpRange{{0, 2}, {5, 5}}, nil},
+		{"bytes=5-9, ,0-1", []httpRange{{5, 5}, {0, 2}}, nil},
+		{"bytes=20000-,0-1", []httpRange{{0, 2}}, nil},
+		// coalesced
+		{"bytes=5-9,0-1,2-4", []httpRange{{0, 10}}, nil},
+		{"bytes=0-100,-9950,9999-", []httpRange{{0, 10000}}, nil},
+		{"bytes=0-100,50-200,500-600", []httpRange{{0, 201}, {500, 101}}, nil},
+		// invalid
+		{"bytes=100-1", nil, errInvalidRange},
+		{"bytes=a-b", nil, errInvalidRange},
+		{"bytes=+1-2", nil, errInvalidRange},
+		{"bytes=1", nil, errInvalidRange},
+		{"bytes=-", nil, errInvalidRange},
+		{"bytes=0-1,x", nil, errInvalidRange},
+		// unsatisfiable
+		{"bytes=10000-", nil, errUnsatisfiableRange},
+		{"bytes=-0", nil, errUnsatisfiableRange},
+		{"bytes=0-0,0-0,0-0,0-0", nil, errTooManyRanges},
 	}
 	for _, v := range cases {
-		start, end := getRequestRange(v.rawRange, v.length)
-		assert.Equal(t, v.start, start)
-		assert.Equal(t, v.end, end)
+		ranges, err := parseRange(v.rawRange, 10000, 3)
+		assert.Equal(t, v.ranges, ranges, v.rawRange)
+		assert.Equal(t, v.err, err, v.rawRange)
 	}
 }
+
+func TestParseETagList(t *testing.T) {
+	cases := []struct {
+		header   string
+		tags     []entityTag
+		wildcard bool
+		ok       bool
+	}{
+		{"*", nil, true, true},
+		{` "abc" `, []entityTag{{`"abc"`, false}}, false, true},
+		{`"abc", W/"abc",,""`, []entityTag{{`"abc"`, false}, {`"abc"`, true}, {`""`, false}}, false, true},
+		{`"a,b"`, []entityTag{{`"a,b"`, false}}, false, true},
+		{"", nil, false, false},
+		{"abc", nil, false, false},
+		{`"abc`, nil, false, false},
+		{`w/"abc"`, nil, false, false},
+		{`"a b"`, nil, false, false},
+		{`"abc" "def"`, nil, false, false},
+		{`"abc", *`, nil, false, false},
+	}
+	for _, v := range cases {
+		tags, wildcard, ok := parseETagList(v.header)
+		assert.Equal(t, v.tags, tags, v.header)
+		assert.Equal(t, v.wildcard, wildcard, v.header)
+		assert.Equal(t, v.ok, ok, v.header)
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	etag := `"xyzzy"`
+	lastModified := time.Date(2022, 2, 22, 12, 0, 0, 500, time.UTC)
+	before := lastModified.Add(-time.Hour).Format(http.TimeFormat)
+	at := lastModified.Format(http.TimeFormat)
+	after := lastModified.Add(time.Hour).Format(http.TimeFormat)
+
+	cases := []struct {
+		method  string
+		headers map[string]string
+		status  int
+		rangeOK bool
+	}{
+		{http.MethodGet, nil, 0, true},
+		{http.MethodGet, map[string]string{"If-Match": `"xyzzy"`}, 0, true},
+		{http.MethodGet, map[string]string{"If-Match": `W/"xyzzy"`}, http.StatusPreconditionFailed, false},
+		{http.MethodGet, map[string]string{"If-Match": "xyzzy"}, http.StatusPreconditionFailed, false},
+		{http.MethodGet, map[string]string{"If-Unmodified-Since": before}, http.StatusPreconditionFailed, false},
+		{http.MethodGet, map[string]string{"If-Unmodified-Since": at}, 0, true},
+		{http.MethodGet, map[string]string{"If-Unmodified-Since": "invalid"}, 0, true},
+		// If-Unmodified-Since is ignored with If-Match
+		{http.MethodGet, map[string]string{"If-Match": "*", "If-Unmodified-Since": before}, 0, true},
+		{http.MethodGet, map[string]string{"If-None-Match": `W/"xyzzy"`}, http.StatusNotModified, false},
+		{http.MethodHead, map[string]string{"If-None-Match": `"xyzzy"`}, http.StatusNotModified, false},
+		{http.MethodPost, map[string]string{"If-None-Match": `"xyzzy"`}, http.StatusPreconditionFailed, false},
+		{http.MethodGet, map[string]string{"If-None-Match": `"xyzzy2"`}, 0, true},
+		{http.MethodGet, map[string]string{"If-Modified-Since": at}, http.StatusNotModified, false},
+		{http.MethodGet, map[string]string{"If-Modified-Since": after}, http.StatusNotModified, false},
+		{http.MethodGet, map[string]string{"If-Modified-Since": before}, 0, true},
+		{http.MethodPost, map[string]string{"If-Modified-Since": at}, 0, true},
+		// If-Modified-Since is ignored with If-None-Match
+		{http.MethodGet, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": after}, 0, true},
+		{http.MethodGet, map[string]string{"If-None-Match": `"other"`, "If-Match": `"other"`}, http.StatusPreconditionFailed, false},
+		// If-Range is only evaluated with Range
+		{http.MethodGet, map[string]string{"If-Range": `"other"`}, 0, true},
+		{http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": `"xyzzy"`}, 0, true},
+		{http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": `W/"xyzzy"`}, 0, false},
+		{http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": `"other"`}, 0, false},
+		{http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": at}, 0, true},
+		{http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": after}, 0, false},
+		{http.MethodGet, map[string]string{"Range": "bytes=0-1", "If-Range": "invalid"}, 0, false},
+	}
+	for _, v := range cases {
+		req := httptest.NewRequest(v.method, "/", nil)
+		for k, value := range v.headers {
+			req.Header.Set(k, value)
+		}
+		status, rangeOK := checkPreconditions(req, etag, lastModified)
+		assert.Equal(t, v.status, status, v)
+		assert.Equal(t, v.rangeOK, rangeOK, v)
+	}
+
+	// without validators only wildcards match
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-Match", "*")
+	req.Header.Set("If-Modified-Since", at)
+	status, _ := checkPreconditions(req, "", time.Time{})
+	assert.Equal(t, 0, status)
+	req.Header.Set("If-None-Match", "*")
+	status, _ = checkPreconditions(req, "", time.Time{})
+	assert.Equal(t, http.StatusNotModified, status)
+}
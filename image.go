@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// glyphs is a 5x7 bitmap font, each row is stored in the low 5 bits.
+// Lowercase letters are drawn in uppercase, except x to render sizes.
+var glyphs = map[rune][7]uint8{
+	' ': {0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b00000},
+	'0': {0b01110, 0b10001, 0b10011, 0b10101, 0b11001, 0b10001, 0b01110},
+	'1': {0b00100, 0b01100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'2': {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b01000, 0b11111},
+	'3': {0b11111, 0b00010, 0b00100, 0b00010, 0b00001, 0b10001, 0b01110},
+	'4': {0b00010, 0b00110, 0b01010, 0b10010, 0b11111, 0b00010, 0b00010},
+	'5': {0b11111, 0b10000, 0b11110, 0b00001, 0b00001, 0b10001, 0b01110},
+	'6': {0b00110, 0b01000, 0b10000, 0b11110, 0b10001, 0b10001, 0b01110},
+	'7': {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b01000, 0b01000},
+	'8': {0b01110, 0b10001, 0b10001, 0b01110, 0b10001, 0b10001, 0b01110},
+	'9': {0b01110, 0b10001, 0b10001, 0b01111, 0b00001, 0b00010, 0b01100},
+	'A': {0b01110, 0b10001, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001},
+	'B': {0b11110, 0b10001, 0b10001, 0b11110, 0b10001, 0b10001, 0b11110},
+	'C': {0b01110, 0b10001, 0b10000, 0b10000, 0b10000, 0b10001, 0b01110},
+	'D': {0b11100, 0b10010, 0b10001, 0b10001, 0b10001, 0b10010, 0b11100},
+	'E': {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b11111},
+	'F': {0b11111, 0b10000, 0b10000, 0b11110, 0b10000, 0b10000, 0b10000},
+	'G': {0b01110, 0b10001, 0b10000, 0b10111, 0b10001, 0b10001, 0b01111},
+	'H': {0b10001, 0b10001, 0b10001, 0b11111, 0b10001, 0b10001, 0b10001},
+	'I': {0b01110, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b01110},
+	'J': {0b00111, 0b00010, 0b00010, 0b00010, 0b00010, 0b10010, 0b01100},
+	'K': {0b10001, 0b10010, 0b10100, 0b11000, 0b10100, 0b10010, 0b10001},
+	'L': {0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b10000, 0b11111},
+	'M': {0b10001, 0b11011, 0b10101, 0b10101, 0b10001, 0b10001, 0b10001},
+	'N': {0b10001, 0b10001, 0b11001, 0b10101, 0b10011, 0b10001, 0b10001},
+	'O': {0b01110, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'P': {0b11110, 0b10001, 0b10001, 0b11110, 0b10000, 0b10000, 0b10000},
+	'Q': {0b01110, 0b10001, 0b10001, 0b10001, 0b10101, 0b10010, 0b01101},
+	'R': {0b11110, 0b10001, 0b10001, 0b11110, 0b10100, 0b10010, 0b10001},
+	'S': {0b01111, 0b10000, 0b10000, 0b01110, 0b00001, 0b00001, 0b11110},
+	'T': {0b11111, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00100},
+	'U': {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01110},
+	'V': {0b10001, 0b10001, 0b10001, 0b10001, 0b10001, 0b01010, 0b00100},
+	'W': {0b10001, 0b10001, 0b10001, 0b10101, 0b10101, 0b10101, 0b01010},
+	'X': {0b10001, 0b10001, 0b01010, 0b00100, 0b01010, 0b10001, 0b10001},
+	'Y': {0b10001, 0b10001, 0b10001, 0b01010, 0b00100, 0b00100, 0b00100},
+	'Z': {0b11111, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b11111},
+	'x': {0b00000, 0b00000, 0b10001, 0b01010, 0b00100, 0b01010, 0b10001},
+	'.': {0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b01100, 0b01100},
+	',': {0b00000, 0b00000, 0b00000, 0b00000, 0b01100, 0b00100, 0b01000},
+	':': {0b00000, 0b01100, 0b01100, 0b00000, 0b01100, 0b01100, 0b00000},
+	'-': {0b00000, 0b00000, 0b00000, 0b11111, 0b00000, 0b00000, 0b00000},
+	'_': {0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b00000, 0b11111},
+	'+': {0b00000, 0b00100, 0b00100, 0b11111, 0b00100, 0b00100, 0b00000},
+	'=': {0b00000, 0b00000, 0b11111, 0b00000, 0b11111, 0b00000, 0b00000},
+	'/': {0b00000, 0b00001, 0b00010, 0b00100, 0b01000, 0b10000, 0b00000},
+	'#': {0b01010, 0b01010, 0b11111, 0b01010, 0b11111, 0b01010, 0b01010},
+	'%': {0b11000, 0b11001, 0b00010, 0b00100, 0b01000, 0b10011, 0b00011},
+	'!': {0b00100, 0b00100, 0b00100, 0b00100, 0b00100, 0b00000, 0b00100},
+	'?': {0b01110, 0b10001, 0b00001, 0b00010, 0b00100, 0b00000, 0b00100},
+	'(': {0b00010, 0b00100, 0b01000, 0b01000, 0b01000, 0b00100, 0b00010},
+	')': {0b01000, 0b00100, 0b00010, 0b00010, 0b00010, 0b00100, 0b01000},
+}
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+func glyph(r rune) [7]uint8 {
+	if g, ok := glyphs[r]; ok {
+		return g
+	}
+	if g, ok := glyphs[unicode.ToUpper(r)]; ok {
+		return g
+	}
+	return glyphs['?']
+}
+
+// drawText draws text centered in img, as large as it fits into 90% of the
+// width and half of the height.
+func drawText(img draw.Image, text string, fg color.Color) {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return
+	}
+	b := img.Bounds()
+	// cells are one pixel wider than glyphs for spacing
+	cellWidth := glyphWidth + 1
+	scale := b.Dx() * 9 / 10 / (cellWidth*len(runes) - 1)
+	if s := b.Dy() / 2 / glyphHeight; s < scale {
+		scale = s
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	x0 := b.Min.X + (b.Dx()-(cellWidth*len(runes)-1)*scale)/2
+	y0 := b.Min.Y + (b.Dy()-glyphHeight*scale)/2
+	src := image.NewUniform(fg)
+	for i, r := range runes {
+		rows := glyph(r)
+		for y, row := range rows {
+			for x := 0; x < glyphWidth; x++ {
+				if row&(1<<(glyphWidth-1-x)) == 0 {
+					continue
+				}
+				px := x0 + (i*cellWidth+x)*scale
+				py := y0 + y*scale
+				draw.Draw(img, image.Rect(px, py, px+scale, py+scale), src, image.Point{}, draw.Over)
+			}
+		}
+	}
+}
+
+// parseHexColor parses colors like fff, ffcc00 and ffcc0080.
+func parseHexColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 || len(s) == 4 {
+		var sb strings.Builder
+		for _, r := range s {
+			sb.WriteRune(r)
+			sb.WriteRune(r)
+		}
+		s = sb.String()
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	// color.RGBA is alpha-premultiplied
+	a := uint16(b[3])
+	return color.RGBA{uint8(uint16(b[0]) * a / 255), uint8(uint16(b[1]) * a / 255), uint8(uint16(b[2]) * a / 255), b[3]}, nil
+}
+
+// parseImageSize parses sizes like 640x480.
+func parseImageSize(s string) (width, height int, err error) {
+	parts := strings.SplitN(strings.ToLower(s), "x", 2)
+	if len(parts) == 2 {
+		width, err = strconv.Atoi(parts[0])
+		if err == nil {
+			height, err = strconv.Atoi(parts[1])
+		}
+	}
+	if len(parts) != 2 || err != nil || width < 1 || height < 1 {
+		return 0, 0, fmt.Errorf("invalid size %q", s)
+	}
+	return width, height, nil
+}
+
+type imageParams struct {
+	// Background color in hex, e.g. ccc or ffcc0080
+	Background string `query:"bg" default:"cccccc"`
+	// Foreground color of the text in hex
+	Foreground string `query:"fg" default:"333333"`
+	// Text drawn in the middle of the image, defaults to the size
+	Text string `query:"text"`
+	// Amount of random noise added to the background from 0 to 100
+	Noise int `query:"noise" default:"0"`
+	// Quality of JPEG images from 1 to 100
+	Quality int `query:"quality" default:"75"`
+	// The number of frames of animated GIF images
+	Frames int `query:"frames" default:"1"`
+	// Delay between frames of animated GIF images in 100ths of a second
+	FrameDelay int `query:"frame_delay" default:"10"`
+	// Size of the image in bytes, reached by padding it with comments
+	Bytes int `query:"bytes"`
+	// Seed of the noise
+	Seed int64 `query:"seed"`
+}
+
+// renderFrame renders the i-th of n frames. Animated frames have a bar
+// moving along the bottom edge.
+func renderFrame(r *rand.Rand, width, height int, ip *imageParams, bg, fg color.RGBA, text string, i, n int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	if ip.Noise > 0 {
+		amplitude := ip.Noise * 255 / 100
+		jitter := func(v uint8) uint8 {
+			x := int(v) + r.Intn(2*amplitude+1) - amplitude
+			if x < 0 {
+				return 0
+			} else if x > int(bg.A) {
+				return bg.A
+			}
+			return uint8(x)
+		}
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2] = jitter(img.Pix[p]), jitter(img.Pix[p+1]), jitter(img.Pix[p+2])
+		}
+	}
+	drawText(img, text, fg)
+	if n > 1 {
+		barWidth, barHeight := width/10+1, height/20+1
+		x := i * (width - barWidth) / (n - 1)
+		draw.Draw(img, image.Rect(x, height-barHeight, x+barWidth, height), image.NewUniform(fg), image.Point{}, draw.Over)
+	}
+	return img
+}
+
+// @Summary   Returns an image of given format and size rendered on the fly.
+// @Tags      Images
+// @Produce   image/png
+// @Produce   image/jpeg
+// @Produce   image/gif
+// @Param     format          path   string  true   "Image format"                                   Enums(png, jpeg, gif)
+// @Param     size            path   string  true   "Width and height of the image"                  default(320x240)
+// @Param     bg              query  string  false  "Background color in hex, e.g. ccc or ffcc0080"  default(cccccc)
+// @Param     fg              query  string  false  "Foreground color of the text in hex"            default(333333)
+// @Param     text            query  string  false  "Text drawn in the middle of the image, defaults to the size"
+// @Param     noise           query  int     false  "Amount of random noise added to the background from 0 to 100"       default(0)
+// @Param     quality         query  int     false  "Quality of JPEG images from 1 to 100"                               default(75)
+// @Param     frames          query  int     false  "The number of frames of animated GIF images"                        default(1)
+// @Param     frame_delay     query  int     false  "Delay between frames of animated GIF images in 100ths of a second"  default(10)
+// @Param     bytes           query  int     false  "Size of the image in bytes, reached by padding it with comments"
+// @Param     seed            query  int     false  "Seed of the noise"
+// @Param     truncate        query  int     false  "Truncate the body at given number of bytes"
+// @Param     flip_bits       query  int     false  "The number of random bits to flip, at most the number of bits of the body"
+// @Param     magic           query  string  false  "Overwrite the start of the body with the magic bytes of another format"  Enums(png, jpeg, gif, webp, pdf, zip, gzip, elf)
+// @Param     content_type    query  string  false  "Content-Type to declare instead of the real one"
+// @Param     content_length  query  int     false  "Content-Length to declare regardless of the actual length, only works with HTTP/1.x"
+// @Response  200             "An image."
+// @Response  400             "Invalid parameters."
+// @Router    /image/{format}/{size} [get]
+func dynamicImageHandler(c echo.Context) error {
+	format := strings.ToLower(c.Param("format"))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	if format != "png" && format != "jpeg" && format != "gif" {
+		return echo.NewHTTPError(http.StatusNotFound, "unknown format")
+	}
+	width, height, err := parseImageSize(c.Param("size"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ip := &imageParams{
+		Background: "cccccc",
+		Foreground: "333333",
+		Quality:    jpeg.DefaultQuality,
+		Frames:     1,
+		FrameDelay: 10,
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, ip); err != nil {
+		return err
+	}
+	bg, err := parseHexColor(ip.Background)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	fg, err := parseHexColor(ip.Foreground)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if ip.Noise < 0 || ip.Noise > 100 || ip.Quality < 1 || ip.Quality > 100 || ip.Frames < 1 || ip.FrameDelay < 0 || ip.Bytes < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid parameters")
+	}
+	if ip.Bytes > conf.Limits.MaxImageBytes {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("bytes must not be greater than %d", conf.Limits.MaxImageBytes))
+	}
+	if format != "gif" {
+		ip.Frames = 1
+	}
+	if max := conf.Limits.MaxImagePixels; width > max/height || ip.Frames > max/(width*height) {
+		return echo.NewHTTPError(http.StatusBadRequest, "image too large")
+	}
+	text := fmt.Sprintf("%dx%d", width, height)
+	if _, ok := c.QueryParams()["text"]; ok {
+		text = ip.Text
+	}
+	r, err := getRand(c)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	switch format {
+	case "png":
+		err = png.Encode(buf, renderFrame(r, width, height, ip, bg, fg, text, 0, 1))
+	case "jpeg":
+		err = jpeg.Encode(buf, renderFrame(r, width, height, ip, bg, fg, text, 0, 1), &jpeg.Options{Quality: ip.Quality})
+	case "gif":
+		// the exact colors are kept in the palette, noise is dithered
+		p := append(color.Palette{bg, fg}, palette.Plan9[:254]...)
+		anim := &gif.GIF{}
+		for i := 0; i < ip.Frames; i++ {
+			frame := image.NewPaletted(image.Rect(0, 0, width, height), p)
+			src := renderFrame(r, width, height, ip, bg, fg, text, i, ip.Frames)
+			if ip.Noise > 0 {
+				draw.FloydSteinberg.Draw(frame, frame.Bounds(), src, image.Point{})
+			} else {
+				draw.Draw(frame, frame.Bounds(), src, image.Point{}, draw.Src)
+			}
+			anim.Image = append(anim.Image, frame)
+			anim.Delay = append(anim.Delay, ip.FrameDelay)
+		}
+		err = gif.EncodeAll(buf, anim)
+	}
+	if err != nil {
+		return err
+	}
+	body := buf.Bytes()
+	if ip.Bytes > 0 {
+		if body, err = padImage(format, body, ip.Bytes, r); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	}
+	return writeMedia(c, "image/"+format, body, r)
+}
+
+// padImage pads an encoded image with comments, which decoders skip, so that
+// it is size bytes long.
+func padImage(format string, img []byte, size int, r *rand.Rand) ([]byte, error) {
+	n := size - len(img)
+	text := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = 'a' + byte(r.Intn(26))
+		}
+		return b
+	}
+	var pad []byte
+	var at int
+	switch format {
+	case "png":
+		// a tEXt chunk before the IEND chunk
+		at = len(img) - 12
+		if n >= 20 {
+			chunk := append([]byte("tEXtComment\x00"), text(n-20)...)
+			pad = binary.BigEndian.AppendUint32(nil, uint32(len(chunk)-4))
+			pad = append(pad, chunk...)
+			pad = binary.BigEndian.AppendUint32(pad, crc32.ChecksumIEEE(chunk))
+		}
+	case "jpeg":
+		// COM segments after the SOI marker, the length of a segment
+		// includes its two length bytes and can't be greater than 65535
+		at = 2
+		for rest := n; rest >= 4; {
+			length := rest - 2
+			if length > 65535 {
+				length = 65535
+				if rest-2-length < 4 {
+					length -= 4
+				}
+			}
+			pad = append(pad, 0xff, 0xfe, byte(length>>8), byte(length))
+			pad = append(pad, text(length-2)...)
+			rest -= 2 + length
+		}
+	case "gif":
+		// a comment extension before the trailer, made of sub-blocks of
+		// at most 255 bytes, which are terminated by an empty one
+		at = len(img) - 1
+		if n >= 3 && n != 4 {
+			pad = []byte{0x21, 0xfe}
+			for rest := n - 3; rest > 0; {
+				block := rest - 1
+				if block > 255 {
+					block = 255
+					if rest-1-block == 1 {
+						block--
+					}
+				}
+				pad = append(pad, byte(block))
+				pad = append(pad, text(block)...)
+				rest -= 1 + block
+			}
+			pad = append(pad, 0)
+		}
+	}
+	if len(pad) != n {
+		return nil, fmt.Errorf("image of %d bytes can not be padded to %d bytes", len(img), size)
+	}
+	padded := make([]byte, 0, size)
+	padded = append(padded, img[:at]...)
+	padded = append(padded, pad...)
+	return append(padded, img[at:]...), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamicImageHandler(t *testing.T) {
+	e := newEcho()
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+
+	cases := []struct {
+		target      string
+		contentType string
+		format      string
+	}{
+		{"/image/png/320x240", "image/png", "png"},
+		{"/image/jpeg/320x240?quality=10", "image/jpeg", "jpeg"},
+		{"/image/jpg/320x240", "image/jpeg", "jpeg"},
+		{"/image/gif/320x240?noise=50", "image/gif", "gif"},
+	}
+	for _, v := range cases {
+		res := get(v.target)
+		assert.Equal(t, http.StatusOK, res.Code, v.target)
+		assert.Equal(t, v.contentType, res.Header().Get("Content-Type"))
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(res.Body.Bytes()))
+		if assert.NoError(t, err, v.target) {
+			assert.Equal(t, v.format, format)
+			assert.Equal(t, 320, cfg.Width)
+			assert.Equal(t, 240, cfg.Height)
+		}
+	}
+
+	// colors and text
+	res := get("/image/png/100x50?bg=f00&fg=00ff00&text=")
+	img, err := png.Decode(res.Body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, color.RGBA{255, 0, 0, 255}, img.At(50, 25))
+	}
+	res = get("/image/png/100x50?bg=f00&fg=00ff00&text=%23")
+	img, err = png.Decode(res.Body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, color.RGBA{0, 255, 0, 255}, img.At(50, 21))
+	}
+
+	// JPEG quality changes the size
+	assert.Greater(t, get("/image/jpeg/320x240?noise=20&quality=90").Body.Len(), get("/image/jpeg/320x240?noise=20&quality=10").Body.Len())
+	_, err = jpeg.Decode(get("/image/jpeg/32x24?quality=100").Body)
+	assert.NoError(t, err)
+
+	// animated GIF
+	res = get("/image/gif/64x32?frames=4&frame_delay=50")
+	anim, err := gif.DecodeAll(res.Body)
+	if assert.NoError(t, err) {
+		assert.Len(t, anim.Image, 4)
+		assert.Equal(t, []int{50, 50, 50, 50}, anim.Delay)
+		assert.NotEqual(t, anim.Image[0].Pix, anim.Image[3].Pix)
+	}
+
+	// noise is seeded
+	res1, res2 := get("/image/png/64x64?noise=50&seed=1"), get("/image/png/64x64?noise=50&seed=1")
+	assert.Equal(t, res1.Body.Bytes(), res2.Body.Bytes())
+	assert.NotEqual(t, res1.Body.Bytes(), get("/image/png/64x64?noise=50&seed=2").Body.Bytes())
+
+	// padded to a given size
+	for _, target := range []string{"/image/png/320x240?bytes=100000", "/image/jpeg/320x240?bytes=100000", "/image/gif/320x240?bytes=100000&frames=2"} {
+		res := get(target)
+		assert.Equal(t, http.StatusOK, res.Code, target)
+		assert.Equal(t, 100000, res.Body.Len(), target)
+		_, _, err := image.Decode(bytes.NewReader(res.Body.Bytes()))
+		assert.NoError(t, err, target)
+	}
+
+	for _, target := range []string{
+		"/image/png/320",
+		"/image/png/0x10",
+		"/image/png/axb",
+		"/image/png/10x10?bg=red",
+		"/image/jpeg/10x10?quality=101",
+		"/image/png/10x10?noise=-1",
+		"/image/png/10x10?bytes=-1",
+		"/image/png/320x240?bytes=100",
+		"/image/png/10x10?bytes=1000000000",
+		"/image/png/100000x100000",
+		"/image/gif/1000x1000?frames=100",
+		// the number of pixels would overflow
+		"/image/gif/4194304x4194304?frames=4194304",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(target).Code, target)
+	}
+	assert.Equal(t, http.StatusNotFound, get("/image/bmp/10x10").Code)
+	// the sample images are still served
+	assert.Equal(t, "image/png", get("/image/png").Header().Get("Content-Type"))
+}
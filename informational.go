@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxEarlyHints limits the number of 103 responses sent before the final one.
+const maxEarlyHints = 10
+
+type earlyHintsParams struct {
+	// Values of the Link headers sent with every hint and the final response
+	Links []string `query:"link"`
+	// The number of 103 Early Hints responses
+	Hints int `query:"hints" default:"1"`
+	// Seconds to wait after every hint
+	Delay float64 `query:"delay" default:"0"`
+}
+
+// @Summary   Sends 103 Early Hints responses with Link headers before the final response.
+// @Tags      Status codes
+// @Produce   json
+// @Param     link   query  []string  false  "Values of the Link headers sent with every hint and the final response"  collectionFormat(multi)
+// @Param     hints  query  int       false  "The number of 103 Early Hints responses"                                 default(1)
+// @Param     delay  query  number    false  "Seconds to wait after every hint"                                        default(0)
+// @Response  103    "Early hints, with the Link headers."
+// @Success   200    {object}  earlyHintsResponse
+// @Router    /early-hints [get]
+func earlyHintsHandler(c echo.Context) error {
+	p := &earlyHintsParams{
+		Hints: 1,
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if len(p.Links) == 0 {
+		p.Links = []string{"</image/png>; rel=preload; as=image", "</image/svg>; rel=preload; as=image"}
+	}
+	if p.Hints < 0 {
+		p.Hints = 0
+	} else if p.Hints > maxEarlyHints {
+		p.Hints = maxEarlyHints
+	}
+	if p.Delay < 0 {
+		p.Delay = 0
+	} else if p.Delay > float64(conf.Limits.MaxDelay)/float64(p.Hints+1) {
+		p.Delay = float64(conf.Limits.MaxDelay) / float64(p.Hints+1)
+	}
+
+	h := c.Response().Header()
+	for _, link := range p.Links {
+		h.Add("Link", link)
+	}
+	// HTTP/1.0 clients don't know about 1xx responses
+	hints := 0
+	if c.Request().ProtoAtLeast(1, 1) {
+		hints = p.Hints
+	}
+	for i := 0; i < hints; i++ {
+		// echo.Response only allows writing the final header
+		c.Response().Writer.WriteHeader(http.StatusEarlyHints)
+		if err := pause(c, time.Duration(p.Delay*1000)*time.Millisecond); err != nil {
+			return err
+		}
+	}
+	return c.JSONPretty(http.StatusOK, &earlyHintsResponse{
+		Hints: hints,
+		Links: p.Links,
+	}, "  ")
+}
+
+type expectParams struct {
+	// What to do about Expect: 100-continue, reject answers with 417 without reading the body
+	Action string `query:"action" enums:"continue,reject,delay" default:"continue"`
+	// The amount of time (in seconds) to wait before 100 Continue, for the delay action
+	Delay float64 `query:"delay" default:"2"`
+}
+
+// @Summary   Handles Expect: 100-continue as requested, and returns anything passed in request data. Go sends 100 Continue once the body is read.
+// @Tags      Status codes
+// @Accept    json
+// @Produce   json
+// @Param     expectParams  query   expectParams  false  "expectParams"
+// @Param     Expect        header  string        false  "Expect"
+// @Response  100           "Continue"
+// @Response  200           "Anything passed in request"
+// @Response  417           "Expectation failed"
+// @Router    /expect [patch]
+// @Router    /expect [post]
+// @Router    /expect [put]
+func expectHandler(c echo.Context) error {
+	p := &expectParams{
+		Action: "continue",
+		Delay:  2,
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if p.Action != "continue" && p.Action != "reject" && p.Action != "delay" {
+		return echo.NewHTTPError(http.StatusBadRequest, "action must be continue, reject or delay")
+	}
+	if p.Delay < 0 {
+		p.Delay = 0
+	} else if p.Delay > float64(conf.Limits.MaxDelay) {
+		p.Delay = float64(conf.Limits.MaxDelay)
+	}
+
+	expect := c.Request().Header.Get("Expect")
+	if expect != "" {
+		switch p.Action {
+		case "reject":
+			return echo.NewHTTPError(http.StatusExpectationFailed, "expectation rejected as requested")
+		case "delay":
+			if err := pause(c, time.Duration(p.Delay*1000)*time.Millisecond); err != nil {
+				return err
+			}
+		}
+	}
+	return c.JSONPretty(http.StatusOK, getAnything(c), "  ")
+}
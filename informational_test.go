@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEarlyHintsHandler(t *testing.T) {
+	s := httptest.NewServer(newEcho())
+	defer s.Close()
+
+	var hints []textproto.MIMEHeader
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			assert.Equal(t, http.StatusEarlyHints, code)
+			hints = append(hints, header)
+			return nil
+		},
+	}
+	get := func(target string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, s.URL+target, nil)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return res
+	}
+
+	res := get("/early-hints?hints=2&link=%3C%2Fstyle.css%3E%3B+rel%3Dpreload%3B+as%3Dstyle&delay=0.01")
+	ehr := earlyHintsResponse{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&ehr))
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 2, ehr.Hints)
+	if assert.Len(t, hints, 2) {
+		assert.Equal(t, []string{"</style.css>; rel=preload; as=style"}, hints[1]["Link"])
+	}
+	assert.Equal(t, []string{"</style.css>; rel=preload; as=style"}, res.Header.Values("Link"))
+
+	hints = nil
+	res = get("/early-hints?hints=100")
+	res.Body.Close()
+	assert.Len(t, hints, maxEarlyHints)
+	assert.Len(t, res.Header.Values("Link"), 2)
+}
+
+func TestExpectHandler(t *testing.T) {
+	s := httptest.NewServer(newEcho())
+	defer s.Close()
+
+	// readResponse sends a request with Expect: 100-continue and returns the
+	// status of the first response, and the final one after sending the body.
+	readResponse := func(target string) (int, int) {
+		conn, err := net.Dial("tcp", s.Listener.Addr().String())
+		if !assert.NoError(t, err) {
+			return 0, 0
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		io.WriteString(conn, "POST "+target+" HTTP/1.1\r\nHost: example.com\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+		r := bufio.NewReader(conn)
+		res, err := http.ReadResponse(r, nil)
+		if !assert.NoError(t, err) {
+			return 0, 0
+		}
+		if res.StatusCode != http.StatusContinue {
+			return res.StatusCode, res.StatusCode
+		}
+		io.WriteString(conn, "hello")
+		final, err := http.ReadResponse(r, nil)
+		if !assert.NoError(t, err) {
+			return 0, 0
+		}
+		body, _ := io.ReadAll(final.Body)
+		assert.Contains(t, string(body), `"data": "hello"`)
+		return res.StatusCode, final.StatusCode
+	}
+
+	first, final := readResponse("/expect")
+	assert.Equal(t, http.StatusContinue, first)
+	assert.Equal(t, http.StatusOK, final)
+	first, _ = readResponse("/expect?action=reject")
+	assert.Equal(t, http.StatusExpectationFailed, first)
+	start := time.Now()
+	first, final = readResponse("/expect?action=delay&delay=0.2")
+	assert.Equal(t, http.StatusContinue, first)
+	assert.Equal(t, http.StatusOK, final)
+	assert.True(t, time.Since(start) >= 200*time.Millisecond)
+
+	// without Expect, requests are never rejected
+	res, err := http.Post(s.URL+"/expect?action=reject", "text/plain", strings.NewReader("hello"))
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	res, err = http.Post(s.URL+"/expect?action=ignore", "text/plain", nil)
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -33,80 +39,170 @@ import (
 func newEcho() (e *echo.Echo) {
 	e = echo.New()
 	e.JSONSerializer = &echobinJSONSerializer{}
+	proxies, _ := parseTrustedProxies(conf.Proxy.Trusted)
+	e.IPExtractor = proxies.extractIP
+	e.HideBanner = !conf.Log.Banner
+	e.Logger.SetLevel(logLevels[strings.ToLower(conf.Log.Level)])
 
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	if conf.Metrics.Enabled {
+		e.Use(metricsMiddleware)
+	}
+	if !strings.EqualFold(conf.Log.AccessFormat, "off") {
+		e.Use(middleware.RequestID())
+		e.Use(newAccessLogger(conf.Log, accessLogOutput).middleware)
+	}
+	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: recoverLogError,
+	}))
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		Skipper:          isCORSPlayground,
+		AllowOrigins:     conf.CORS.AllowOrigins,
+		AllowMethods:     conf.CORS.AllowMethods,
+		AllowHeaders:     conf.CORS.AllowHeaders,
+		AllowCredentials: conf.CORS.AllowCredentials,
+		ExposeHeaders:    conf.CORS.ExposeHeaders,
+		MaxAge:           conf.CORS.MaxAge,
+	}))
+
+	g := e.Group(conf.Routes.BasePath)
+	if conf.Routes.BasePath != "" {
+		e.GET(conf.Routes.BasePath, func(c echo.Context) error {
+			return c.Redirect(http.StatusMovedPermanently, conf.Routes.BasePath+"/")
+		})
+	}
 
 	// Swagger docs
-	e.GET("/*", swaggerUIHandler)
-	e.GET("/swagger.json", swaggerDocHandler)
+	g.GET("/*", swaggerUIHandler)
+	g.GET("/swagger.json", swaggerDocHandler)
+	// Health and metrics, not part of the docs
+	g.GET("/healthz", healthzHandler)
+	g.GET("/readyz", readyzHandler)
+	if conf.Metrics.Enabled {
+		g.GET("/metrics", metricsHandler())
+	}
 	// HTTP methods
-	e.GET("/get", getMethodHandler)
-	e.POST("/post", otherMethodHandler)
-	e.PUT("/put", otherMethodHandler)
-	e.PATCH("/patch", otherMethodHandler)
-	e.DELETE("/delete", otherMethodHandler)
+	if conf.Routes.enabled("HTTP methods") {
+		g.GET("/get", getMethodHandler)
+		g.POST("/post", otherMethodHandler)
+		g.PUT("/put", otherMethodHandler)
+		g.PATCH("/patch", otherMethodHandler)
+		g.DELETE("/delete", otherMethodHandler)
+	}
 	// Auth
-	e.GET("/basic-auth/:user/:passwd", basicAuthHandler, middleware.BasicAuth(basicAuthValidator))
-	e.GET("/bearer", bearerHandler)
+	if conf.Routes.enabled("Auth") {
+		g.GET("/basic-auth/:user/:passwd", basicAuthHandler, middleware.BasicAuth(basicAuthValidator))
+		g.GET("/bearer", bearerHandler)
+	}
 	// Status Codes
-	e.Any("/status/:codes", statusCodesHandler)
+	if conf.Routes.enabled("Status codes") {
+		g.Any("/status/:codes", statusCodesHandler)
+		g.GET("/early-hints", earlyHintsHandler)
+		g.Match([]string{http.MethodPatch, http.MethodPost, http.MethodPut}, "/expect", expectHandler)
+	}
 	// Request inspection
-	e.GET("/headers", requestHeadersHandler)
-	e.GET("/ip", requestIPHandler)
-	e.GET("/user-agent", requestUserAgentHandler)
+	if conf.Routes.enabled("Request inspection") {
+		g.GET("/headers", requestHeadersHandler)
+		g.GET("/ip", requestIPHandler)
+		g.GET("/user-agent", requestUserAgentHandler)
+	}
 	// Response inspection
-	e.GET("/cache", cacheHandler)
-	e.GET("/cache/:value", cacheDurationHandler)
-	e.GET("/etag/:etag", etagHandler)
-	e.GET("/response-headers", responseHeadersHandler)
-	e.POST("/response-headers", responseHeadersHandler)
+	if conf.Routes.enabled("Response inspection") {
+		g.GET("/cache", cacheHandler)
+		g.GET("/cache/:value", cacheDurationHandler)
+		g.GET("/etag/:etag", etagHandler)
+		g.Match([]string{http.MethodGet, http.MethodHead}, "/cache-test/:key", cacheTestHandler)
+		g.GET("/cache-test/:key/stats", cacheTestStatsHandler)
+		g.DELETE("/cache-test/:key/stats", cacheTestResetHandler)
+		g.POST("/cache-test/:key/version", cacheTestVersionHandler)
+		g.Any("/cors", corsHandler)
+		g.Any("/cors/*", corsHandler)
+		g.GET("/security-headers", securityHeadersHandler)
+		g.GET("/csp-report", cspReportsHandler)
+		g.POST("/csp-report", cspReportHandler)
+		g.DELETE("/csp-report", deleteCSPReportsHandler)
+		g.GET("/response-headers", responseHeadersHandler)
+		g.POST("/response-headers", responseHeadersHandler)
+	}
 	// Response formats
-	e.GET("/html", serveHTMLHandler)
-	e.GET("/xml", serveXMLHandler)
-	e.GET("/json", serveJSONHandler)
-	e.GET("/robots.txt", serveRobotsTXTHandler)
-	e.GET("/deny", serveDenyHandler)
-	e.GET("/encoding/utf8", serveUTF8HTMLHandler)
-	e.GET("/gzip", serveGzipHandler, middleware.Gzip())
-	e.GET("/deflate", serveDeflateHandler, middleware.Deflate())
-	e.GET("/brotli", serveBrotliHandler)
+	if conf.Routes.enabled("Response formats") {
+		g.GET("/html", serveHTMLHandler)
+		g.GET("/xml", serveXMLHandler)
+		g.GET("/json", serveJSONHandler)
+		g.GET("/robots.txt", serveRobotsTXTHandler)
+		g.GET("/deny", serveDenyHandler)
+		g.GET("/encoding/utf8", serveUTF8HTMLHandler)
+		g.GET("/gzip", serveGzipHandler, middleware.Gzip())
+		g.GET("/deflate", serveDeflateHandler, middleware.Deflate())
+		g.GET("/brotli", serveBrotliHandler)
+		g.GET("/generate/:format", generateDocumentHandler)
+		g.GET("/bomb/:n", bombHandler)
+	}
 	// Dynamic data
-	e.GET("/base64/:value", base64Handler)
-	e.GET("/bytes/:n", generateBytesHandler)
-	e.Any("/delay/:delay", delayHandler)
-	e.GET("/drip", dripHandler)
-	e.GET("/links/:n/:offset", linksHandler).Name = "links"
-	e.GET("/range/:numbytes", rangeHandler)
-	e.GET("/stream-bytes/:n", streamBytesHandler)
-	e.GET("/stream/:n", streamHandler)
-	e.GET("/uuid", UUIDHandler)
+	if conf.Routes.enabled("Dynamic data") {
+		g.GET("/base64/:value", base64Handler)
+		g.GET("/bytes/:n", generateBytesHandler)
+		g.Any("/delay/:delay", delayHandler)
+		g.Match([]string{http.MethodGet, http.MethodHead}, "/download/:size", downloadHandler, trackStream)
+		g.GET("/drip", dripHandler, trackStream)
+		g.GET("/links/:n/:offset", linksHandler).Name = "links"
+		g.Match([]string{http.MethodGet, http.MethodPost}, "/random/json", randomJSONHandler)
+		g.GET("/range/:numbytes", rangeHandler)
+		g.GET("/stream-bytes/:n", streamBytesHandler, trackStream)
+		g.GET("/stream/:n", streamHandler)
+		g.GET("/trailers/:n", trailersHandler, trackStream)
+		g.GET("/uuid", UUIDHandler)
+	}
 	// Cookies
-	e.GET("/cookies", getCookiesHandler)
-	e.GET("/cookies/delete", deleteCookiesHandler)
-	e.GET("/cookies/set", setCookiesInQueryHandler)
-	e.GET("/cookies/set/:name/:value", setCookiesInPathHandler)
+	if conf.Routes.enabled("Cookies") {
+		g.GET("/cookies", getCookiesHandler)
+		g.GET("/cookies/delete", deleteCookiesHandler)
+		g.GET("/cookies/set", setCookiesInQueryHandler)
+		g.GET("/cookies/set/:name/:value", setCookiesInPathHandler)
+		g.Match([]string{http.MethodGet, http.MethodPost}, "/cookies/set-advanced", setAdvancedCookieHandler)
+		g.GET("/cookies/scenarios", cookieScenariosHandler)
+		g.GET("/cookies/scenarios/:name", cookieScenarioHandler)
+		g.GET("/cookies/scenarios/:name/*", cookieScenarioHandler)
+		g.GET("/session", getSessionHandler)
+		g.GET("/session/new", newSessionHandler)
+		g.GET("/session/set", setSessionHandler)
+		g.GET("/session/delete", deleteSessionHandler)
+		g.GET("/session/rotate", rotateSessionHandler)
+		g.GET("/session/expire", expireSessionHandler)
+		g.GET("/session/tamper", tamperSessionHandler)
+	}
 	// Images
-	e.GET("/image", imageHandler)
-	e.GET("/image/webp", imageWebPHandler)
-	e.GET("/image/svg", imageSVGHandler)
-	e.GET("/image/jpeg", imageJPEGHandler)
-	e.GET("/image/png", imagePNGHandler)
+	if conf.Routes.enabled("Images") {
+		g.GET("/image", imageHandler)
+		g.GET("/image/webp", imageWebPHandler)
+		g.GET("/image/svg", imageSVGHandler)
+		g.GET("/image/jpeg", imageJPEGHandler)
+		g.GET("/image/png", imagePNGHandler)
+		g.GET("/image/:format/:size", dynamicImageHandler)
+	}
 	// Redirects
-	e.GET("/redirect-to", getRedirectToHandler)
-	e.Match([]string{
-		http.MethodDelete,
-		http.MethodPatch,
-		http.MethodPost,
-		http.MethodPut,
-	}, "/redirect-to", otherRedirectToHandler)
-	e.GET("/redirect/:n", redirectHandler)
-	e.GET("/absolute-redirect/:n", absoluteRedirectHandler)
-	e.GET("/relative-redirect/:n", relativeRedirectHandler)
+	if conf.Routes.enabled("Redirects") {
+		g.GET("/redirect-to", getRedirectToHandler)
+		g.Match([]string{
+			http.MethodDelete,
+			http.MethodPatch,
+			http.MethodPost,
+			http.MethodPut,
+		}, "/redirect-to", otherRedirectToHandler)
+		g.GET("/redirect/:n", redirectHandler)
+		g.GET("/absolute-redirect/:n", absoluteRedirectHandler)
+		g.GET("/relative-redirect/:n", relativeRedirectHandler)
+		g.GET("/refresh-redirect/:n", refreshRedirectHandler)
+		g.GET("/meta-redirect/:n", metaRedirectHandler)
+		g.GET("/js-redirect/:n", jsRedirectHandler)
+		g.Any("/redirect-chain", redirectChainHandler)
+		g.Any("/redirect-chain/landing", redirectLandingHandler)
+	}
 	// Anything
-	e.Any("/anything*", anythingHandler)
+	if conf.Routes.enabled("Anything") {
+		g.Any("/anything*", anythingHandler)
+	}
 	// Other Utilities
-	e.GET("/forms/post", formHandler)
+	g.GET("/forms/post", formHandler)
 
 	return
 }
@@ -121,10 +217,40 @@ func newEcho() (e *echo.Echo) {
 // @contact.url    https://github.com/masakichi/echobin
 // @contact.email  self@gimo.me
 func main() {
+	cfg, printConfig, err := loadConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if printConfig {
+		if err := writeConfig(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	conf = cfg
+
 	e := newEcho()
-	listenAddr := os.Getenv("LISTEN_ADDR")
-	if listenAddr == "" {
-		listenAddr = ":8080"
+	go func() {
+		var err error
+		if conf.TLS.CertFile != "" {
+			err = e.StartTLS(conf.ListenAddr, conf.TLS.CertFile, conf.TLS.KeyFile)
+		} else {
+			err = e.Start(conf.ListenAddr)
+		}
+		if err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop() // a second signal kills the process right away
+	if err := drain(e, conf.Shutdown); err != nil {
+		e.Logger.Fatal(err)
 	}
-	e.Logger.Fatal(e.Start(listenAddr))
 }
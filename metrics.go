@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "echobin",
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "echobin",
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route and method.",
+		// /delay, /drip and /range may take up to a minute by default
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method"})
+
+	httpResponseBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "echobin",
+		Name:      "http_response_bytes_total",
+		Help:      "Total number of response body bytes written by route and method.",
+	}, []string{"route", "method"})
+
+	httpStreamsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "echobin",
+		Name:      "http_streams_in_flight",
+		Help:      "Number of streaming responses currently being served by route.",
+	}, []string{"route"})
+
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "echobin",
+		Name:      "build_info",
+		Help:      "A metric with a constant '1' value labeled by version, revision and goversion.",
+	}, []string{"version", "revision", "goversion"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		httpRequestsTotal,
+		httpRequestDuration,
+		httpResponseBytesTotal,
+		httpStreamsInFlight,
+		buildInfo,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	buildInfo.WithLabelValues(version, revision, runtime.Version()).Set(1)
+}
+
+// metricsMiddleware records request count, latency and bytes written of
+// every request, labelled by the route it matched.
+func metricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) (err error) {
+		start := time.Now()
+		if err = next(c); err != nil {
+			// Let the error handler write the response so the final status
+			// code is known, the same as middleware.Logger does.
+			c.Error(err)
+		}
+		route, method := c.Path(), c.Request().Method
+		httpRequestsTotal.WithLabelValues(route, method, strconv.Itoa(c.Response().Status)).Inc()
+		httpRequestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+		httpResponseBytesTotal.WithLabelValues(route, method).Add(float64(c.Response().Size))
+		return
+	}
+}
+
+// trackStream counts the streaming responses in flight.
+func trackStream(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		g := httpStreamsInFlight.WithLabelValues(c.Path())
+		g.Inc()
+		defer g.Dec()
+		return next(c)
+	}
+}
+
+func metricsHandler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+}
+
+// ready reports whether the server accepts new traffic, 1 for ready.
+var ready int32 = 1
+
+func healthzHandler(c echo.Context) error {
+	return c.JSONPretty(http.StatusOK, &healthResponse{Status: "ok"}, "  ")
+}
+
+func readyzHandler(c echo.Context) error {
+	if atomic.LoadInt32(&ready) != 1 {
+		return c.JSONPretty(http.StatusServiceUnavailable, &healthResponse{Status: "unavailable"}, "  ")
+	}
+	return c.JSONPretty(http.StatusOK, &healthResponse{Status: "ok"}, "  ")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	e := newEcho()
+
+	for _, target := range []string{"/get", "/bytes/10", "/bytes/x", "/stream-bytes/10"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	body := res.Body.String()
+	assert.Contains(t, body, `echobin_http_requests_total{code="200",method="GET",route="/get"}`)
+	assert.Contains(t, body, `echobin_http_requests_total{code="400",method="GET",route="/bytes/:n"}`)
+	assert.Contains(t, body, `echobin_http_request_duration_seconds_bucket{method="GET",route="/bytes/:n",le="0.005"}`)
+	assert.Contains(t, body, `echobin_http_response_bytes_total{method="GET",route="/stream-bytes/:n"}`)
+	assert.Contains(t, body, `echobin_http_streams_in_flight{route="/stream-bytes/:n"} 0`)
+	assert.Contains(t, body, `echobin_build_info{goversion=`)
+}
+
+func TestHealthHandlers(t *testing.T) {
+	e := newEcho()
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	atomic.StoreInt32(&ready, 0)
+	defer atomic.StoreInt32(&ready, 1)
+	req = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+
+	// liveness is not affected by readiness
+	req = httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+}
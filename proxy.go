@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// trustedProxies resolves the client IP of requests by walking the
+// forwarding chain from the direct peer backwards, as long as the hops are
+// trusted proxies.
+type trustedProxies []*net.IPNet
+
+func parseTrustedProxies(cidrs []string) (trustedProxies, error) {
+	var tp trustedProxies
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		tp = append(tp, ipNet)
+	}
+	return tp, nil
+}
+
+func (tp trustedProxies) trusts(ip net.IP) bool {
+	for _, ipNet := range tp {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractIP implements echo.IPExtractor.
+func (tp trustedProxies) extractIP(r *http.Request) string {
+	peer := getPeer(r)
+	ip := net.ParseIP(peer)
+	if ip == nil || !tp.trusts(ip) {
+		return peer
+	}
+	chain := forwardedFor(r)
+	if len(chain) == 0 {
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+			return realIP.String()
+		}
+		return peer
+	}
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := net.ParseIP(stripPort(chain[i]))
+		if hop == nil {
+			// obfuscated or unknown identifiers, e.g. for=_hidden
+			break
+		}
+		client = hop.String()
+		if !tp.trusts(hop) {
+			break
+		}
+	}
+	return client
+}
+
+func getPeer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedFor returns the addresses a request was forwarded for, the client
+// first. The Forwarded header takes precedence over X-Forwarded-For.
+func forwardedFor(r *http.Request) []string {
+	var chain []string
+	if forwarded := parseForwarded(r.Header.Values("Forwarded")); len(forwarded) > 0 {
+		for _, f := range forwarded {
+			if f.For != "" {
+				chain = append(chain, f.For)
+			}
+		}
+		return chain
+	}
+	return splitHeaderList(r.Header.Values(echo.HeaderXForwardedFor))
+}
+
+// parseForwarded parses Forwarded header values.
+// see also: https://datatracker.ietf.org/doc/html/rfc7239#section-4
+func parseForwarded(values []string) []forwardedElement {
+	var elements []forwardedElement
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			var fe forwardedElement
+			for _, pair := range splitQuoted(element, ';') {
+				kv := strings.SplitN(pair, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v := strings.TrimSpace(kv[1])
+				if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+					v = strings.ReplaceAll(v[1:len(v)-1], `\"`, `"`)
+				}
+				switch strings.ToLower(strings.TrimSpace(kv[0])) {
+				case "for":
+					fe.For = v
+				case "by":
+					fe.By = v
+				case "host":
+					fe.Host = v
+				case "proto":
+					fe.Proto = v
+				}
+			}
+			if fe != (forwardedElement{}) {
+				elements = append(elements, fe)
+			}
+		}
+	}
+	return elements
+}
+
+// splitQuoted splits s by sep, ignoring separators in quoted strings.
+func splitQuoted(s string, sep rune) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i, r := range s {
+		switch {
+		case r == '"' && (i == 0 || s[i-1] != '\\'):
+			quoted = !quoted
+		case r == sep && !quoted:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+func splitHeaderList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// stripPort removes the port and IPv6 brackets from node identifiers like
+// "[2001:db8::1]:4711" and "192.0.2.43:8080".
+func stripPort(node string) string {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return strings.Trim(node, "[]")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedProxiesExtractIP(t *testing.T) {
+	tp, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	cases := []struct {
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		// untrusted peer
+		{"203.0.113.9:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.9"},
+		{"203.0.113.9:1234", map[string]string{"X-Real-IP": "1.1.1.1"}, "203.0.113.9"},
+		// trusted peer without forwarding headers
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", map[string]string{"X-Real-IP": "1.1.1.1"}, "1.1.1.1"},
+		// walks back through trusted hops only
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 10.0.0.2"}, "1.1.1.1"},
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 8.8.8.8, 10.0.0.2"}, "8.8.8.8"},
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"[2001:db8::1]:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "1.1.1.1"},
+		// Forwarded takes precedence and unknown identifiers stop the walk
+		{"192.0.2.1:1234", map[string]string{"Forwarded": `for="[2001:db8::2]:80"`, "X-Forwarded-For": "1.1.1.1"}, "2001:db8::2"},
+		{"192.0.2.1:1234", map[string]string{"Forwarded": "for=1.1.1.1, for=_hidden, for=10.0.0.2"}, "10.0.0.2"},
+	}
+	for _, v := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = v.remoteAddr
+		for k, h := range v.headers {
+			req.Header.Set(k, h)
+		}
+		assert.Equal(t, v.expected, tp.extractIP(req), v)
+	}
+
+	_, err = parseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = parseTrustedProxies([]string{"proxy.local"})
+	assert.Error(t, err)
+}
+
+func TestParseForwarded(t *testing.T) {
+	values := []string{
+		`For="[2001:db8:cafe::17]:4711"; proto=http;by=203.0.113.43`,
+		`for=192.0.2.43, for=198.51.100.17;host="example.com;a,b"`,
+		`garbage`,
+	}
+	assert.Equal(t, []forwardedElement{
+		{For: "[2001:db8:cafe::17]:4711", By: "203.0.113.43", Proto: "http"},
+		{For: "192.0.2.43"},
+		{For: "198.51.100.17", Host: "example.com;a,b"},
+	}, parseForwarded(values))
+}
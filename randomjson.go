@@ -0,0 +1,621 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const mimeApplicationNDJSON = "application/x-ndjson"
+
+// maxSchemaDepth stops recursive schemas, e.g. trees defined with $ref.
+const maxSchemaDepth = 16
+
+var (
+	fakeFirstNames = []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi", "ivan", "judy", "mallory", "oscar", "peggy", "trent", "victor", "walter"}
+	fakeLastNames  = []string{"smith", "johnson", "tanaka", "garcia", "muller", "rossi", "dubois", "kim", "nguyen", "silva", "novak", "jensen"}
+	fakeDomains    = []string{"example.com", "example.net", "example.org"}
+	fakeWords      = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua"}
+)
+
+// schemaGenerator generates random JSON documents valid against a JSON
+// Schema. Only the commonly used subset of the specification is supported,
+// keywords it doesn't understand are ignored.
+type schemaGenerator struct {
+	r    *rand.Rand
+	root interface{}
+	// size is the number of bytes of all documents generated so far as
+	// encoded in the response, which must not grow larger than
+	// conf.Limits.MaxDocumentBytes
+	size int
+	// indent is the indentation level of the documents in the response
+	indent int
+}
+
+func (g *schemaGenerator) generate(schema interface{}, depth int) (interface{}, error) {
+	if depth > maxSchemaDepth {
+		return nil, fmt.Errorf("schema is nested deeper than %d levels", maxSchemaDepth)
+	}
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return nil, fmt.Errorf("false schema can not be satisfied")
+		}
+		return g.generate(map[string]interface{}{}, depth)
+	case map[string]interface{}:
+		return g.generateObjectSchema(s, depth)
+	default:
+		return nil, fmt.Errorf("schema must be an object or a boolean")
+	}
+}
+
+func (g *schemaGenerator) generateObjectSchema(s map[string]interface{}, depth int) (interface{}, error) {
+	if ref, ok := s["$ref"].(string); ok {
+		resolved, err := g.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		return g.generate(resolved, depth+1)
+	}
+	if v, ok := s["const"]; ok {
+		return v, g.add(v, depth)
+	}
+	if enum, ok := s["enum"].([]interface{}); ok && len(enum) > 0 {
+		v := enum[g.r.Intn(len(enum))]
+		return v, g.add(v, depth)
+	}
+	if allOf, ok := s["allOf"].([]interface{}); ok {
+		return g.generate(mergeSchemas(s, allOf), depth+1)
+	}
+	for _, k := range []string{"oneOf", "anyOf"} {
+		if choices, ok := s[k].([]interface{}); ok && len(choices) > 0 {
+			merged := mergeSchemas(s, []interface{}{choices[g.r.Intn(len(choices))]})
+			delete(merged, k)
+			return g.generate(merged, depth+1)
+		}
+	}
+
+	var v interface{}
+	var err error
+	switch t := g.schemaType(s); t {
+	case "object":
+		return g.generateObject(s, depth)
+	case "array":
+		return g.generateArray(s, depth)
+	case "string":
+		v, err = g.generateString(s)
+	case "integer":
+		v, err = g.generateInteger(s)
+	case "number":
+		v, err = g.generateNumber(s)
+	case "boolean":
+		v = g.r.Intn(2) == 1
+	case "null":
+		v = nil
+	default:
+		return nil, fmt.Errorf("unsupported type %q", t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, g.add(v, depth)
+}
+
+// schemaType picks one of the allowed types, or guesses the type from the
+// keywords used when there is no type keyword.
+func (g *schemaGenerator) schemaType(s map[string]interface{}) string {
+	switch t := s["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		if len(t) > 0 {
+			if name, ok := t[g.r.Intn(len(t))].(string); ok {
+				return name
+			}
+		}
+	}
+	guesses := []struct {
+		keywords []string
+		typ      string
+	}{
+		{[]string{"properties", "required", "additionalProperties"}, "object"},
+		{[]string{"items", "prefixItems", "minItems", "maxItems"}, "array"},
+		{[]string{"format", "minLength", "maxLength", "pattern"}, "string"},
+		{[]string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf"}, "number"},
+	}
+	for _, guess := range guesses {
+		for _, k := range guess.keywords {
+			if _, ok := s[k]; ok {
+				return guess.typ
+			}
+		}
+	}
+	return []string{"string", "integer", "number", "boolean"}[g.r.Intn(4)]
+}
+
+// resolve resolves local references like #/definitions/foo and #/$defs/foo.
+// see also: https://datatracker.ietf.org/doc/html/rfc6901
+func (g *schemaGenerator) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local references are supported, got %q", ref)
+	}
+	node := g.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token, _ = url.PathUnescape(token)
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch n := node.(type) {
+		case map[string]interface{}:
+			node = n[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("unresolvable reference %q", ref)
+			}
+			node = n[i]
+		default:
+			node = nil
+		}
+		if node == nil {
+			return nil, fmt.Errorf("unresolvable reference %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// mergeSchemas merges subschemas into the parent schema, uniting properties
+// and required keywords. It is good enough for the usual allOf patterns.
+func mergeSchemas(parent map[string]interface{}, subschemas []interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range parent {
+		if k != "allOf" {
+			merged[k] = v
+		}
+	}
+	for _, sub := range subschemas {
+		subschema, ok := sub.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k, v := range subschema {
+			switch k {
+			case "properties":
+				properties := map[string]interface{}{}
+				if existing, ok := merged[k].(map[string]interface{}); ok {
+					for name, p := range existing {
+						properties[name] = p
+					}
+				}
+				if added, ok := v.(map[string]interface{}); ok {
+					for name, p := range added {
+						properties[name] = p
+					}
+				}
+				merged[k] = properties
+			case "required":
+				existing, _ := merged[k].([]interface{})
+				added, _ := v.([]interface{})
+				merged[k] = append(append([]interface{}{}, existing...), added...)
+			default:
+				merged[k] = v
+			}
+		}
+	}
+	return merged
+}
+
+func (g *schemaGenerator) generateObject(s map[string]interface{}, depth int) (interface{}, error) {
+	// braces
+	if err := g.add(struct{}{}, depth); err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	properties, _ := s["properties"].(map[string]interface{})
+	required := map[string]bool{}
+	if names, ok := s["required"].([]interface{}); ok {
+		for _, name := range names {
+			if n, ok := name.(string); ok {
+				required[n] = true
+			}
+		}
+	}
+	// Sorted to be deterministic for a given seed
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !required[name] && g.r.Intn(4) == 0 {
+			continue
+		}
+		if err := g.addKey(name); err != nil {
+			return nil, err
+		}
+		v, err := g.generate(properties[name], depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		obj[name] = v
+	}
+	// Required properties without a definition can be anything
+	for name := range required {
+		if _, ok := obj[name]; !ok {
+			word := g.randomWord()
+			if err := g.addKey(name); err != nil {
+				return nil, err
+			}
+			if err := g.add(word, depth+1); err != nil {
+				return nil, err
+			}
+			obj[name] = word
+		}
+	}
+	return obj, nil
+}
+
+func (g *schemaGenerator) generateArray(s map[string]interface{}, depth int) (interface{}, error) {
+	minItems, maxItems := intKeyword(s, "minItems", 0), intKeyword(s, "maxItems", -1)
+	if maxItems < 0 {
+		maxItems = minItems + 5
+	}
+	if maxItems > minItems+100 {
+		maxItems = minItems + 100
+	}
+	if minItems > maxItems {
+		return nil, fmt.Errorf("minItems is greater than maxItems")
+	}
+	n := minItems + g.r.Intn(maxItems-minItems+1)
+	// brackets and commas
+	if err := g.add([]struct{}{}, depth); err != nil {
+		return nil, err
+	}
+	if err := g.grow(n); err != nil {
+		return nil, err
+	}
+
+	// tuples are defined with prefixItems since draft 2020-12, or with an
+	// array of items before
+	prefixItems, _ := s["prefixItems"].([]interface{})
+	if tuple, ok := s["items"].([]interface{}); ok {
+		prefixItems = tuple
+	}
+	var itemSchema interface{} = true
+	if items, ok := s["items"]; ok {
+		if _, isTuple := items.([]interface{}); !isTuple {
+			itemSchema = items
+		}
+	}
+
+	arr := make([]interface{}, 0, n)
+	seen := map[string]bool{}
+	unique, _ := s["uniqueItems"].(bool)
+	for attempts := 0; len(arr) < n && attempts < n*10; attempts++ {
+		schema := itemSchema
+		if len(arr) < len(prefixItems) {
+			schema = prefixItems[len(arr)]
+		}
+		v, err := g.generate(schema, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if unique {
+			key, _ := json.Marshal(v)
+			if seen[string(key)] {
+				continue
+			}
+			seen[string(key)] = true
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func (g *schemaGenerator) generateString(s map[string]interface{}) (interface{}, error) {
+	var str string
+	switch format, _ := s["format"].(string); format {
+	case "email":
+		str = fmt.Sprintf("%s.%s@%s", g.pick(fakeFirstNames), g.pick(fakeLastNames), g.pick(fakeDomains))
+	case "date-time":
+		str = g.randomTime().Format(time.RFC3339)
+	case "date":
+		str = g.randomTime().Format("2006-01-02")
+	case "time":
+		str = g.randomTime().Format("15:04:05Z07:00")
+	case "uri", "url", "iri":
+		str = fmt.Sprintf("https://www.%s/%s/%s", g.pick(fakeDomains), g.randomWord(), g.randomWord())
+	case "hostname", "idn-hostname":
+		str = fmt.Sprintf("%s.%s", g.randomWord(), g.pick(fakeDomains))
+	case "uuid":
+		id, _ := uuid.NewRandomFromReader(g.r)
+		str = id.String()
+	case "ipv4":
+		str = net.IPv4(byte(g.r.Intn(224)), byte(g.r.Intn(256)), byte(g.r.Intn(256)), byte(1+g.r.Intn(254))).String()
+	case "ipv6":
+		ip := make(net.IP, net.IPv6len)
+		g.r.Read(ip)
+		ip[0], ip[1] = 0x20, 0x01 // global unicast
+		str = ip.String()
+	default:
+		words := make([]string, 1+g.r.Intn(4))
+		for i := range words {
+			words[i] = g.randomWord()
+		}
+		str = strings.Join(words, " ")
+	}
+
+	minLength, maxLength := intKeyword(s, "minLength", 0), intKeyword(s, "maxLength", -1)
+	// checked before the string is built, it is added by the caller
+	if err := g.fits(minLength); err != nil {
+		return nil, err
+	}
+	if n := utf8.RuneCountInString(str); n < minLength {
+		sb := &strings.Builder{}
+		sb.WriteString(str)
+		for n < minLength {
+			word := g.randomWord()
+			sb.WriteString(" ")
+			sb.WriteString(word)
+			n += 1 + utf8.RuneCountInString(word)
+		}
+		str = sb.String()
+	}
+	if maxLength >= 0 && utf8.RuneCountInString(str) > maxLength {
+		str = string([]rune(str)[:maxLength])
+	}
+	return str, nil
+}
+
+// fits checks whether n more bytes can be generated.
+func (g *schemaGenerator) fits(n int) error {
+	if n > conf.Limits.MaxDocumentBytes-g.size {
+		return fmt.Errorf("documents would be larger than %d bytes", conf.Limits.MaxDocumentBytes)
+	}
+	return nil
+}
+
+// grow adds n bytes to the size of the generated documents.
+func (g *schemaGenerator) grow(n int) error {
+	if err := g.fits(n); err != nil {
+		return err
+	}
+	g.size += n
+	return nil
+}
+
+// add adds the size of v encoded at the given depth, including the newline
+// and indentation of pretty printed documents.
+func (g *schemaGenerator) add(v interface{}, depth int) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return g.grow(len(b) + 1 + 2*(depth+g.indent))
+}
+
+// addKey adds the size of an object key, its colon and its comma.
+func (g *schemaGenerator) addKey(name string) error {
+	b, _ := json.Marshal(name)
+	return g.grow(len(b) + 3)
+}
+
+// numberRange returns the inclusive bounds of numeric schemas, supporting
+// both the boolean (draft 4) and numeric (draft 6+) exclusive keywords.
+func numberRange(s map[string]interface{}, step float64) (min, max float64) {
+	min, max = math.Inf(-1), math.Inf(1)
+	if v, ok := s["minimum"].(float64); ok {
+		min = v
+		if exclusive, _ := s["exclusiveMinimum"].(bool); exclusive {
+			min += step
+		}
+	}
+	if v, ok := s["maximum"].(float64); ok {
+		max = v
+		if exclusive, _ := s["exclusiveMaximum"].(bool); exclusive {
+			max -= step
+		}
+	}
+	if v, ok := s["exclusiveMinimum"].(float64); ok && v+step > min {
+		min = v + step
+	}
+	if v, ok := s["exclusiveMaximum"].(float64); ok && v-step < max {
+		max = v - step
+	}
+	switch {
+	case math.IsInf(min, -1) && math.IsInf(max, 1):
+		min, max = 0, 1000
+	case math.IsInf(min, -1):
+		min = max - 1000
+	case math.IsInf(max, 1):
+		max = min + 1000
+	}
+	return min, max
+}
+
+func (g *schemaGenerator) generateInteger(s map[string]interface{}) (interface{}, error) {
+	min, max := numberRange(s, 1)
+	lo, hi := math.Ceil(min), math.Floor(max)
+	if multipleOf, ok := s["multipleOf"].(float64); ok && multipleOf >= 1 && multipleOf == math.Trunc(multipleOf) {
+		lo, hi = math.Ceil(lo/multipleOf), math.Floor(hi/multipleOf)
+		if math.IsInf(lo, 0) || math.IsInf(hi, 0) {
+			return nil, fmt.Errorf("too many multiples of %v in range", multipleOf)
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("no multiple of %v in range", multipleOf)
+		}
+		return integerValue(g.randomInteger(lo, hi) * multipleOf), nil
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("minimum is greater than maximum")
+	}
+	return integerValue(g.randomInteger(lo, hi)), nil
+}
+
+// randomInteger returns a random integer in [lo, hi]. Ranges too wide for
+// int64 are sampled as floats, which are integers at that magnitude.
+func (g *schemaGenerator) randomInteger(lo, hi float64) float64 {
+	if lo >= -(1<<61) && hi < 1<<61 {
+		return float64(int64(lo) + g.r.Int63n(int64(hi)-int64(lo)+1))
+	}
+	f := g.r.Float64()
+	// interpolated so that hi-lo can't overflow
+	return math.Max(lo, math.Min(hi, math.Round(lo*(1-f)+hi*f)))
+}
+
+// integerValue returns x as an int64 if it fits, so that it is encoded
+// without an exponent.
+func integerValue(x float64) interface{} {
+	if x >= math.MinInt64 && x < math.MaxInt64 {
+		return int64(x)
+	}
+	return x
+}
+
+func (g *schemaGenerator) generateNumber(s map[string]interface{}) (interface{}, error) {
+	if multipleOf, ok := s["multipleOf"].(float64); ok && multipleOf > 0 {
+		min, max := numberRange(s, multipleOf)
+		lo, hi := math.Ceil(min/multipleOf), math.Floor(max/multipleOf)
+		if math.IsInf(lo, 0) || math.IsInf(hi, 0) {
+			return nil, fmt.Errorf("too many multiples of %v in range", multipleOf)
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("no multiple of %v in range", multipleOf)
+		}
+		return g.randomInteger(lo, hi) * multipleOf, nil
+	}
+	min, max := numberRange(s, 0.01)
+	if min > max {
+		return nil, fmt.Errorf("minimum is greater than maximum")
+	}
+	// Rounded to two decimals to look like real data
+	x := math.Round((min+g.r.Float64()*(max-min))*100) / 100
+	return math.Max(min, math.Min(max, x)), nil
+}
+
+func (g *schemaGenerator) pick(choices []string) string {
+	return choices[g.r.Intn(len(choices))]
+}
+
+func (g *schemaGenerator) randomWord() string {
+	return g.pick(fakeWords)
+}
+
+// randomTime returns a time between 2000 and 2030.
+func (g *schemaGenerator) randomTime() time.Time {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	return start.Add(time.Duration(g.r.Int63n(int64(30*365*24*time.Hour/time.Second))) * time.Second)
+}
+
+func intKeyword(s map[string]interface{}, k string, fallback int) int {
+	if v, ok := s[k].(float64); ok && v >= 0 {
+		// large enough to be rejected, without overflowing
+		return int(math.Min(v, math.MaxInt32))
+	}
+	return fallback
+}
+
+type randomJSONParams struct {
+	// JSON Schema of the documents, can be posted as the request body instead
+	Schema string `query:"schema"`
+	// The amount of documents, an array is returned if greater than 1
+	Count int `query:"count" default:"1"`
+	// Set to ndjson to stream newline delimited documents
+	Format string `query:"format"`
+	// Seed of the random documents
+	Seed int64 `query:"seed"`
+}
+
+// @Summary   Generates random JSON documents valid against a JSON Schema.
+// @Tags      Dynamic data
+// @Accept    json
+// @Produce   json
+// @Produce   application/x-ndjson
+// @Param     randomJSONParams  query  randomJSONParams  false  "randomJSONParams"
+// @Param     schema            body   object            false  "JSON Schema"
+// @Response  200               "Random JSON documents."
+// @Response  400               "Invalid schema."
+// @Router    /random/json [get]
+// @Router    /random/json [post]
+func randomJSONHandler(c echo.Context) error {
+	rp := &randomJSONParams{
+		Count: 1,
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, rp); err != nil {
+		return err
+	}
+	if rp.Count < 1 {
+		rp.Count = 1
+	} else if rp.Count > conf.Limits.MaxRandomCount {
+		rp.Count = conf.Limits.MaxRandomCount
+	}
+	rawSchema := rp.Schema
+	if rawSchema == "" {
+		rawSchema = getData(c)
+	}
+	if strings.TrimSpace(rawSchema) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "schema is required")
+	}
+	var schema interface{}
+	if err := json.Unmarshal([]byte(rawSchema), &schema); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid schema: "+err.Error())
+	}
+	r, err := getRand(c)
+	if err != nil {
+		return err
+	}
+	g := &schemaGenerator{r: r, root: schema}
+
+	ndjson := rp.Format == "ndjson" || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), mimeApplicationNDJSON)
+	if !ndjson {
+		if rp.Count > 1 {
+			g.indent = 1
+		}
+		docs := make([]interface{}, rp.Count)
+		for i := range docs {
+			if docs[i], err = g.generate(schema, 0); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid schema: "+err.Error())
+			}
+		}
+		if rp.Count == 1 {
+			return c.JSONPretty(http.StatusOK, docs[0], "  ")
+		}
+		return c.JSONPretty(http.StatusOK, docs, "  ")
+	}
+
+	// Validate the schema before the response is committed
+	first, err := g.generate(schema, 0)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid schema: "+err.Error())
+	}
+	c.Response().Header().Set(echo.HeaderContentType, mimeApplicationNDJSON)
+	c.Response().WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(c.Response())
+	enc.SetEscapeHTML(false)
+	for i := 0; i < rp.Count; i++ {
+		doc := first
+		if i > 0 {
+			if err := pause(c, 0); err != nil {
+				return err
+			}
+			if doc, err = g.generate(schema, 0); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		c.Response().Flush()
+	}
+	return nil
+}
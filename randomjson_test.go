@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["id", "email", "created", "home", "ip", "age", "score", "tags", "role", "address", "nullable", "point"],
+  "properties": {
+    "id": {"type": "string", "format": "uuid"},
+    "email": {"type": "string", "format": "email"},
+    "created": {"type": "string", "format": "date-time"},
+    "home": {"type": "string", "format": "uri"},
+    "ip": {"type": "string", "format": "ipv4"},
+    "age": {"type": "integer", "minimum": 18, "exclusiveMaximum": 21},
+    "score": {"type": "number", "minimum": 0, "maximum": 1, "multipleOf": 0.25},
+    "tags": {"type": "array", "items": {"enum": ["a", "b", "c"]}, "minItems": 2, "maxItems": 3, "uniqueItems": true},
+    "role": {"const": "admin"},
+    "address": {"$ref": "#/$defs/address"},
+    "nullable": {"type": ["null"]},
+    "point": {"prefixItems": [{"type": "integer"}, {"type": "boolean"}], "minItems": 2, "maxItems": 2}
+  },
+  "$defs": {
+    "address": {
+      "allOf": [
+        {"properties": {"city": {"type": "string", "minLength": 20, "maxLength": 25}}, "required": ["city"]},
+        {"properties": {"zip": {"type": "string", "maxLength": 5}}, "required": ["zip"]}
+      ]
+    }
+  }
+}`
+
+func TestRandomJSONHandler(t *testing.T) {
+	e := newEcho()
+
+	req := httptest.NewRequest(http.MethodPost, "/random/json?seed=1", strings.NewReader(testSchema))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	var doc struct {
+		ID      string   `json:"id"`
+		Email   string   `json:"email"`
+		Created string   `json:"created"`
+		Home    string   `json:"home"`
+		IP      string   `json:"ip"`
+		Age     int      `json:"age"`
+		Score   float64  `json:"score"`
+		Tags    []string `json:"tags"`
+		Role    string   `json:"role"`
+		Address struct {
+			City string `json:"city"`
+			Zip  string `json:"zip"`
+		} `json:"address"`
+		Nullable interface{}   `json:"nullable"`
+		Point    []interface{} `json:"point"`
+	}
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &doc)) {
+		_, err := uuid.Parse(doc.ID)
+		assert.NoError(t, err)
+		assert.Regexp(t, `^\w+\.\w+@example\.(com|net|org)$`, doc.Email)
+		_, err = time.Parse(time.RFC3339, doc.Created)
+		assert.NoError(t, err)
+		u, err := url.Parse(doc.Home)
+		assert.NoError(t, err)
+		assert.Equal(t, "https", u.Scheme)
+		assert.NotNil(t, net.ParseIP(doc.IP).To4())
+		assert.True(t, doc.Age >= 18 && doc.Age < 21, doc.Age)
+		assert.Contains(t, []float64{0, 0.25, 0.5, 0.75, 1}, doc.Score)
+		assert.True(t, len(doc.Tags) >= 2 && len(doc.Tags) <= 3)
+		assert.NotEqual(t, doc.Tags[0], doc.Tags[1])
+		assert.Equal(t, "admin", doc.Role)
+		assert.True(t, len(doc.Address.City) >= 20 && len(doc.Address.City) <= 25, doc.Address.City)
+		assert.LessOrEqual(t, len(doc.Address.Zip), 5)
+		assert.Nil(t, doc.Nullable)
+		if assert.Len(t, doc.Point, 2) {
+			assert.IsType(t, float64(0), doc.Point[0])
+			assert.IsType(t, true, doc.Point[1])
+		}
+	}
+
+	// the same seed generates the same documents, also from the query
+	req = httptest.NewRequest(http.MethodGet, "/random/json?seed=1&schema="+url.QueryEscape(testSchema), nil)
+	res2 := httptest.NewRecorder()
+	e.ServeHTTP(res2, req)
+	assert.Equal(t, res.Body.String(), res2.Body.String())
+}
+
+func TestRandomJSONHandlerCount(t *testing.T) {
+	e := newEcho()
+	schema := url.QueryEscape(`{"type": "object", "properties": {"n": {"type": "integer"}}, "required": ["n"]}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/random/json?count=3&schema="+schema, nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	var docs []map[string]int
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &docs))
+	assert.Len(t, docs, 3)
+
+	for _, target := range []string{"/random/json?count=4&format=ndjson&schema=", "/random/json?count=4&schema="} {
+		req = httptest.NewRequest(http.MethodGet, target+schema, nil)
+		req.Header.Set(echo.HeaderAccept, mimeApplicationNDJSON)
+		res = httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		assert.Equal(t, mimeApplicationNDJSON, res.Header().Get(echo.HeaderContentType))
+		lines := strings.Split(strings.TrimSuffix(res.Body.String(), "\n"), "\n")
+		if assert.Len(t, lines, 4) {
+			for _, line := range lines {
+				assert.Regexp(t, `^\{"n":\d+\}$`, line)
+			}
+		}
+	}
+}
+
+func TestRandomJSONHandlerInvalidSchema(t *testing.T) {
+	e := newEcho()
+	cases := []string{
+		``,
+		`{`,
+		`"string"`,
+		`false`,
+		`{"$ref": "#/definitions/missing"}`,
+		`{"$ref": "https://example.com/schema.json"}`,
+		`{"type": "integer", "minimum": 10, "maximum": 5}`,
+		`{"type": "widget"}`,
+		`{"$ref": "#"}`,
+		// documents would be too large
+		`{"type": "string", "minLength": 2000000}`,
+		`{"type": "array", "minItems": 3000000}`,
+		`{"type": "array", "minItems": 1e300}`,
+		`{"type": "array", "minItems": 1100, "items": {"type": "array", "minItems": 1000}}`,
+		`{"type": "number", "multipleOf": 1e-300, "minimum": -1e300, "maximum": 1e300}`,
+	}
+	for _, schema := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/random/json", strings.NewReader(schema))
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusBadRequest, res.Code, schema)
+	}
+}
+
+func TestRandomJSONHandlerDocumentSize(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Limits.MaxDocumentBytes = 20000
+	e := newEcho()
+
+	// nested arrays are counted by their encoded size, not their items
+	nested := `{"type": "array", "minItems": 100, "items": {"type": "array", "minItems": 100, "items": {"type": "string", "minLength": 90}}}`
+	req := httptest.NewRequest(http.MethodPost, "/random/json", strings.NewReader(nested))
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	// the limit applies to the whole response
+	schema := `{"type": "array", "minItems": 10, "maxItems": 10, "items": {"type": "string", "minLength": 90, "maxLength": 90}}`
+	for _, target := range []string{"/random/json?count=5", "/random/json?count=5&format=ndjson", "/random/json?count=50&format=ndjson"} {
+		req = httptest.NewRequest(http.MethodPost, target, strings.NewReader(schema))
+		res = httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code, target)
+		assert.Greater(t, res.Body.Len(), 0, target)
+		assert.LessOrEqual(t, res.Body.Len(), conf.Limits.MaxDocumentBytes, target)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/random/json?count=50", strings.NewReader(schema))
+	res = httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestRandomJSONHandlerLargeRanges(t *testing.T) {
+	e := newEcho()
+	cases := []struct {
+		schema   string
+		min, max float64
+	}{
+		{`{"type": "integer", "minimum": -9e18, "maximum": 9e18}`, -9e18, 9e18},
+		{`{"type": "integer", "minimum": -1e30, "maximum": 1e30, "multipleOf": 7}`, -1e30, 1e30},
+		{`{"type": "number", "multipleOf": 1e-17}`, 0, 1000},
+		{`{"type": "integer", "minimum": 5, "maximum": 5}`, 5, 5},
+	}
+	for _, v := range cases {
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/random/json", strings.NewReader(v.schema))
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+			if assert.Equal(t, http.StatusOK, res.Code, v.schema) {
+				var x float64
+				assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &x))
+				assert.True(t, x >= v.min && x <= v.max, "%v not in [%v, %v]", x, v.min, v.max)
+			}
+		}
+	}
+
+	// long strings are built in linear time
+	req := httptest.NewRequest(http.MethodPost, "/random/json", strings.NewReader(`{"type": "string", "minLength": 200000}`))
+	res := httptest.NewRecorder()
+	start := time.Now()
+	e.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Less(t, time.Since(start), time.Second)
+	var str string
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &str)) {
+		assert.GreaterOrEqual(t, len(str), 200000)
+	}
+}
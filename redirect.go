@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxRedirectTrace is the number of hops passed along to the landing
+// endpoint, so that looping chains don't grow their URLs forever.
+const maxRedirectTrace = 20
+
+type redirectChainParams struct {
+	// Hops of the chain, each a redirect status optionally followed by @ and the origin to redirect to, e.g. 307@http://localhost:8080
+	Hops []string `query:"hop"`
+	// Index of the current hop
+	Index int `query:"i"`
+	// Whether to start over after the last hop, forever
+	Loop bool `query:"loop"`
+	// Where the last hop redirects to, the landing endpoint by default
+	To string `query:"to"`
+	// Requests of the chain so far
+	Trace []string `query:"trace"`
+}
+
+// redirectChainHop is a hop of /redirect-chain, redirecting with status to
+// the same path of origin, or of the current origin if empty.
+type redirectChainHop struct {
+	status int
+	origin string
+}
+
+func parseRedirectChainHop(s string) (redirectChainHop, error) {
+	parts := strings.SplitN(s, "@", 2)
+	hop := redirectChainHop{}
+	hop.status, _ = strconv.Atoi(parts[0])
+	switch hop.status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return hop, fmt.Errorf("invalid hop %q, status must be one of 301, 302, 303, 307 and 308", s)
+	}
+	if len(parts) == 2 {
+		u, err := url.Parse(parts[1])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+			return hop, fmt.Errorf("invalid hop %q, origins are like https://example.com:8443", s)
+		}
+		hop.origin = u.Scheme + "://" + u.Host
+	}
+	return hop, nil
+}
+
+// formatRedirectHop describes a request of a chain, see parseRedirectHop.
+func formatRedirectHop(c echo.Context, status int) string {
+	req := c.Request()
+	return fmt.Sprintf("%d %s %t %d %s://%s", status, req.Method, req.Header.Get(echo.HeaderAuthorization) != "", len(getData(c)), c.Scheme(), req.Host)
+}
+
+func parseRedirectHop(s string) (redirectHop, bool) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return redirectHop{}, false
+	}
+	status, err1 := strconv.Atoi(fields[0])
+	authorization, err2 := strconv.ParseBool(fields[2])
+	bodyBytes, err3 := strconv.Atoi(fields[3])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return redirectHop{}, false
+	}
+	return redirectHop{
+		Status:        status,
+		Method:        fields[1],
+		Authorization: authorization,
+		BodyBytes:     bodyBytes,
+		Origin:        fields[4],
+	}, true
+}
+
+// @Summary   Redirects along a chain of hops, with given statuses and origins, and lands on an endpoint showing the method, body and headers which survived. Clients may change POST to GET on 301 and 302 redirects, and change any method but HEAD to GET on 303.
+// @Tags      Redirects
+// @Accept    json
+// @Produce   plain
+// @Param     hop    query  []string  false  "Hops of the chain, each a redirect status optionally followed by @ and the origin to redirect to, e.g. 307@http://localhost:8080"  collectionFormat(multi)
+// @Param     i      query  int       false  "Index of the current hop"
+// @Param     loop   query  bool      false  "Whether to start over after the last hop, forever"
+// @Param     to     query  string    false  "Where the last hop redirects to, the landing endpoint by default"
+// @Param     trace  query  []string  false  "Requests of the chain so far"  collectionFormat(multi)
+// @Response  302    "A redirection with the status of the hop."
+// @Router    /redirect-chain [delete]
+// @Router    /redirect-chain [get]
+// @Router    /redirect-chain [patch]
+// @Router    /redirect-chain [post]
+// @Router    /redirect-chain [put]
+func redirectChainHandler(c echo.Context) error {
+	p := &redirectChainParams{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if len(p.Hops) == 0 {
+		p.Hops = []string{strconv.Itoa(http.StatusFound)}
+	}
+	if len(p.Hops) > conf.Limits.MaxRedirectHops {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("number of hops must not be greater than %d", conf.Limits.MaxRedirectHops))
+	}
+	if p.Index < 0 || p.Index >= len(p.Hops) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid hop index")
+	}
+	hop, err := parseRedirectChainHop(p.Hops[p.Index])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	trace := append(p.Trace, formatRedirectHop(c, hop.status))
+	if len(trace) > maxRedirectTrace {
+		trace = trace[len(trace)-maxRedirectTrace:]
+	}
+	next := p.Index + 1
+	if next == len(p.Hops) && p.Loop {
+		next = 0
+	}
+	if next == len(p.Hops) && p.To != "" {
+		return c.Redirect(hop.status, p.To)
+	}
+	query := url.Values{"trace": trace}
+	target := c.Echo().URI(redirectLandingHandler)
+	if next < len(p.Hops) {
+		query.Set("i", strconv.Itoa(next))
+		query["hop"] = p.Hops
+		query.Set("loop", strconv.FormatBool(p.Loop))
+		if p.To != "" {
+			query.Set("to", p.To)
+		}
+		target = c.Echo().URI(redirectChainHandler)
+	}
+	return c.Redirect(hop.status, hop.origin+target+"?"+query.Encode())
+}
+
+// @Summary  The end of /redirect-chain. Returns anything passed in request data, and the requests of the chain.
+// @Tags     Redirects
+// @Accept   json
+// @Produce  json
+// @Param    trace  query     []string  false  "Requests of the chain"  collectionFormat(multi)
+// @Success  200    {object}  redirectLandingResponse
+// @Router   /redirect-chain/landing [delete]
+// @Router   /redirect-chain/landing [get]
+// @Router   /redirect-chain/landing [patch]
+// @Router   /redirect-chain/landing [post]
+// @Router   /redirect-chain/landing [put]
+func redirectLandingHandler(c echo.Context) error {
+	res := &redirectLandingResponse{
+		anythingResponse: *getAnything(c),
+		Hops:             []redirectHop{},
+	}
+	for _, v := range c.QueryParams()["trace"] {
+		if hop, ok := parseRedirectHop(v); ok {
+			res.Hops = append(res.Hops, hop)
+		}
+	}
+	return c.JSONPretty(http.StatusOK, res, "  ")
+}
+
+type clientRedirectParams struct {
+	// Seconds to wait before redirecting (max of 10 seconds)
+	Delay int `query:"delay" default:"0"`
+	// How JavaScript redirects navigate
+	Method string `query:"method" enums:"href,assign,replace" default:"href"`
+}
+
+//go:embed templates/redirect.html
+var redirectTemplate string
+
+var redirectPage = template.Must(template.New("redirect").Parse(redirectTemplate))
+
+// clientRedirect redirects n times like redirect, but leaves following the
+// redirects to the client, with a Refresh header, a meta refresh or a script
+// as of kind. Params are passed along the chain, but not to /get.
+func clientRedirect(kind string, h echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p := &clientRedirectParams{Method: "href"}
+		if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+			return err
+		}
+		if p.Delay < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid number of delay")
+		} else if p.Delay > conf.Limits.MaxDelay {
+			p.Delay = conf.Limits.MaxDelay
+		}
+		if p.Method != "href" && p.Method != "assign" && p.Method != "replace" {
+			return echo.NewHTTPError(http.StatusBadRequest, "method must be href, assign or replace")
+		}
+		uri, last, err := nextRedirect(c, h, false)
+		if err != nil {
+			return err
+		}
+		if q := c.QueryString(); q != "" && !last {
+			uri += "?" + q
+		}
+
+		if kind == "refresh" {
+			c.Response().Header().Set("Refresh", fmt.Sprintf("%d; url=%s", p.Delay, uri))
+			return c.String(http.StatusOK, fmt.Sprintf("Redirecting to %s in %d seconds.", uri, p.Delay))
+		}
+		buf := new(bytes.Buffer)
+		if err := redirectPage.Execute(buf, map[string]interface{}{
+			"Kind":   kind,
+			"URL":    uri,
+			"Delay":  p.Delay,
+			"Millis": p.Delay * 1000,
+			"Method": p.Method,
+		}); err != nil {
+			return err
+		}
+		return c.Blob(http.StatusOK, echo.MIMETextHTMLCharsetUTF8, buf.Bytes())
+	}
+}
+
+// @Summary   Redirects n times with a Refresh header, which clients follow after the delay.
+// @Tags      Redirects
+// @Produce   plain
+// @Param     n                     path   int                   true   "n"
+// @Param     clientRedirectParams  query  clientRedirectParams  false  "clientRedirectParams"
+// @Response  200                   "A page with a Refresh header."
+// @Router    /refresh-redirect/{n} [get]
+func refreshRedirectHandler(c echo.Context) error {
+	return clientRedirect("refresh", refreshRedirectHandler)(c)
+}
+
+// @Summary   Redirects n times with an HTML meta refresh, which browsers follow after the delay.
+// @Tags      Redirects
+// @Produce   html
+// @Param     n                     path   int                   true   "n"
+// @Param     clientRedirectParams  query  clientRedirectParams  false  "clientRedirectParams"
+// @Response  200                   "A page with a meta refresh."
+// @Router    /meta-redirect/{n} [get]
+func metaRedirectHandler(c echo.Context) error {
+	return clientRedirect("meta", metaRedirectHandler)(c)
+}
+
+// @Summary   Redirects n times by setting location with JavaScript after the delay.
+// @Tags      Redirects
+// @Produce   html
+// @Param     n                     path   int                   true   "n"
+// @Param     clientRedirectParams  query  clientRedirectParams  false  "clientRedirectParams"
+// @Response  200                   "A page with a redirecting script."
+// @Router    /js-redirect/{n} [get]
+func jsRedirectHandler(c echo.Context) error {
+	return clientRedirect("js", jsRedirectHandler)(c)
+}
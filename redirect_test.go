@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectChainHandler(t *testing.T) {
+	s := httptest.NewServer(newEcho())
+	defer s.Close()
+	other := strings.Replace(s.URL, "127.0.0.1", "localhost", 1)
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL+"/redirect-chain?hop=307&hop=308@"+url.QueryEscape(other)+"&hop=302&hop=303", strings.NewReader("hello"))
+	req.Header.Set("Authorization", "Bearer token")
+	statuses := []int{}
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		statuses = append(statuses, req.Response.StatusCode)
+		return nil
+	}}
+	res, err := client.Do(req)
+	if assert.NoError(t, err) {
+		landing := redirectLandingResponse{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&landing))
+		res.Body.Close()
+		assert.Equal(t, []int{307, 308, 302, 303}, statuses)
+		assert.Equal(t, http.MethodGet, landing.Method)
+		assert.Empty(t, landing.Data)
+		assert.NotContains(t, landing.Headers, "Authorization")
+		assert.True(t, strings.HasPrefix(landing.URL, other+"/redirect-chain/landing?"), landing.URL)
+		assert.Equal(t, []redirectHop{
+			{307, http.MethodPost, true, 5, s.URL},
+			{308, http.MethodPost, true, 5, s.URL},
+			// Go drops the Authorization header on cross-origin redirects
+			{302, http.MethodPost, false, 5, other},
+			{303, http.MethodGet, false, 0, other},
+		}, landing.Hops)
+	}
+
+	// same origin redirects keep the method, body and headers
+	req, _ = http.NewRequest(http.MethodPut, s.URL+"/redirect-chain?hop=308&hop=307", strings.NewReader("hello"))
+	req.Header.Set("Authorization", "Bearer token")
+	res, err = http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		landing := redirectLandingResponse{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&landing))
+		res.Body.Close()
+		assert.Equal(t, http.MethodPut, landing.Method)
+		assert.Equal(t, "hello", landing.Data)
+		assert.Equal(t, "Bearer token", landing.Headers["Authorization"])
+		assert.Len(t, landing.Hops, 2)
+	}
+
+	// loops go on forever
+	errStop := errors.New("stop")
+	client = &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 50 {
+			return errStop
+		}
+		return nil
+	}}
+	res, err = client.Get(s.URL + "/redirect-chain?hop=301&hop=302&loop=true")
+	assert.True(t, errors.Is(err, errStop))
+	if assert.NotNil(t, res) {
+		assert.Equal(t, http.StatusFound, res.StatusCode)
+		location, _ := url.Parse(res.Header.Get("Location"))
+		assert.Equal(t, "/redirect-chain", location.Path)
+		assert.Len(t, location.Query()["trace"], maxRedirectTrace)
+	}
+
+	res, err = http.Get(s.URL + "/redirect-chain?hop=303&to=/get")
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, "/get", res.Request.URL.Path)
+	}
+	res, err = http.Get(s.URL + "/redirect-chain")
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, "/redirect-chain/landing", res.Request.URL.Path)
+	}
+
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Limits.MaxRedirectHops = 3
+	e := newEcho()
+	for _, target := range []string{
+		"/redirect-chain?hop=300",
+		"/redirect-chain?hop=302@ftp://example.com",
+		"/redirect-chain?hop=302@http://example.com/path",
+		"/redirect-chain?hop=302&i=1",
+		"/redirect-chain?hop=302&hop=302&hop=302&hop=302",
+	} {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, res.Code, target)
+	}
+}
+
+func TestClientRedirectHandlers(t *testing.T) {
+	e := newEcho()
+	serve := func(target string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(http.MethodGet, target, nil))
+		return res
+	}
+
+	res := serve("/refresh-redirect/3?delay=2")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "2; url=/refresh-redirect/2?delay=2", res.Header().Get("Refresh"))
+	res = serve("/refresh-redirect/1?delay=100")
+	assert.Equal(t, "10; url=/get", res.Header().Get("Refresh"))
+
+	res = serve("/meta-redirect/2?delay=1&x=a%26b")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, echo.MIMETextHTMLCharsetUTF8, res.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, res.Body.String(), `<meta http-equiv="refresh" content="1; url=/meta-redirect/1?delay=1&amp;x=a%26b">`)
+	assert.NotContains(t, res.Body.String(), "<script>")
+
+	res = serve("/js-redirect/1?method=replace")
+	assert.Contains(t, res.Body.String(), `location.replace("/get");`)
+	assert.NotContains(t, res.Body.String(), `http-equiv`)
+	res = serve("/js-redirect/2")
+	assert.Contains(t, res.Body.String(), `location.href = "/js-redirect/1";`)
+
+	for _, target := range []string{
+		"/refresh-redirect/-1",
+		"/meta-redirect/1?delay=-1",
+		"/js-redirect/1?method=open",
+	} {
+		assert.Equal(t, http.StatusBadRequest, serve(target).Code, target)
+	}
+}
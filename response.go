@@ -1,6 +1,10 @@
 package main
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type anythingResponse struct {
 	Args    map[string]interface{} `json:"args"`
@@ -12,6 +16,24 @@ type anythingResponse struct {
 	Method  string                 `json:"method"`
 	Origin  string                 `json:"origin"`
 	URL     string                 `json:"url"`
+	// Trailers sent after the request body, if any
+	Trailers map[string]string `json:"trailers,omitempty"`
+}
+
+// redirectHop is a request of /redirect-chain.
+type redirectHop struct {
+	// Status the request was redirected with
+	Status        int    `json:"status"`
+	Method        string `json:"method"`
+	Authorization bool   `json:"authorization"`
+	BodyBytes     int    `json:"body_bytes"`
+	Origin        string `json:"origin"`
+}
+
+type redirectLandingResponse struct {
+	anythingResponse
+	// The requests of the chain, the last ones only of long chains
+	Hops []redirectHop `json:"hops"`
 }
 
 type getMethodResponse struct {
@@ -37,7 +59,25 @@ type requestHeadersResponse struct {
 }
 
 type requestIPResponse struct {
+	// The client IP resolved through trusted proxies
 	Origin string `json:"origin"`
+	// The address of the direct peer
+	Peer string `json:"peer"`
+	// The forwarding chain joined by commas, the client first
+	Chain           string             `json:"chain"`
+	Forwarded       []forwardedElement `json:"forwarded,omitempty"`
+	XForwardedFor   []string           `json:"x-forwarded-for,omitempty"`
+	XForwardedHost  []string           `json:"x-forwarded-host,omitempty"`
+	XForwardedProto []string           `json:"x-forwarded-proto,omitempty"`
+	XForwardedPort  []string           `json:"x-forwarded-port,omitempty"`
+	XRealIP         string             `json:"x-real-ip,omitempty"`
+}
+
+type forwardedElement struct {
+	For   string `json:"for,omitempty"`
+	By    string `json:"by,omitempty"`
+	Host  string `json:"host,omitempty"`
+	Proto string `json:"proto,omitempty"`
 }
 
 type requestUserAgentResponse struct {
@@ -93,4 +133,101 @@ type UUIDResponse struct {
 
 type cookiesResponse struct {
 	Cookies map[string]string `json:"cookies"`
+	// The Cookie header as received, which keeps the order and duplicates
+	Header string `json:"header"`
+}
+
+type setCookieResponse struct {
+	SetCookie string `json:"set_cookie"`
+	// Why browsers would reject the cookie, if they would
+	Warnings []string `json:"warnings"`
+}
+
+type cookieScenarioInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Where to start the scenario
+	URL string `json:"url"`
+}
+
+type cookieScenarioCheck struct {
+	// URL of the step the cookies were received by
+	Step     string   `json:"step"`
+	Passed   bool     `json:"passed"`
+	Ordered  bool     `json:"ordered"`
+	Expected []string `json:"expected"`
+	Received []string `json:"received"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type cookieScenarioResponse struct {
+	Scenario string                `json:"scenario"`
+	Passed   bool                  `json:"passed"`
+	Checks   []cookieScenarioCheck `json:"checks"`
+}
+
+type sessionResponse struct {
+	Valid bool `json:"valid"`
+	// Why the session is invalid
+	Error   string   `json:"error,omitempty"`
+	Session *session `json:"session,omitempty"`
+}
+
+type corsPreflight struct {
+	Time   time.Time `json:"time"`
+	Origin string    `json:"origin"`
+	Path   string    `json:"path"`
+	// The requested method
+	Method string `json:"method"`
+	// The requested headers
+	Headers []string `json:"headers"`
+	// Whether private network access was requested
+	PrivateNetwork bool `json:"private_network"`
+	// Status the preflight was answered with
+	Status int `json:"status"`
+}
+
+type corsResponse struct {
+	Origin string `json:"origin"`
+	Method string `json:"method"`
+	// CORS headers of the response
+	Headers map[string]string `json:"headers"`
+	// The last preflight for the request, if any
+	Preflight *corsPreflight `json:"preflight"`
+}
+
+type securityHeadersResponse struct {
+	// The security headers of the response
+	Headers map[string]string `json:"headers"`
+}
+
+type cspReport struct {
+	Received time.Time `json:"received"`
+	// Either report-uri or reporting-api
+	Format string `json:"format"`
+	Type   string `json:"type"`
+	// The document the report is about
+	URL       string                 `json:"url"`
+	UserAgent string                 `json:"user_agent"`
+	Body      map[string]interface{} `json:"body"`
+}
+
+type earlyHintsResponse struct {
+	// The number of 103 responses sent
+	Hints int `json:"hints"`
+	// The links of the hints
+	Links []string `json:"links"`
+}
+
+// problemResponse is an RFC 9457 problem detail.
+type problemResponse struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
 }
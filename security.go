@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxCSPReportBytes limits the size of report bodies, browsers send a few
+// kilobytes at most.
+const maxCSPReportBytes = 64 << 10
+
+const (
+	mimeCSPReport     = "application/csp-report"
+	mimeReportsJSON   = "application/reports+json"
+	cspReportEndpoint = "csp-endpoint"
+)
+
+type securityHeadersParams struct {
+	// Values of headers not given, strict ones or none
+	Preset string `query:"preset" enums:"strict,none" default:"strict"`
+	// Headers to send malformed values of, unless given
+	Malformed []string `query:"malformed" enums:"csp,csp_report_only,reporting_endpoints,hsts,x_frame_options,x_content_type_options,referrer_policy,permissions_policy,coop,coep,corp"`
+	// Content-Security-Policy, left out if off
+	CSP string `query:"csp"`
+	// Content-Security-Policy-Report-Only, left out if off
+	CSPReportOnly string `query:"csp_report_only"`
+	// Reporting-Endpoints, left out if off
+	ReportingEndpoints string `query:"reporting_endpoints"`
+	// Strict-Transport-Security, left out if off
+	HSTS string `query:"hsts"`
+	// X-Frame-Options, left out if off
+	XFrameOptions string `query:"x_frame_options"`
+	// X-Content-Type-Options, left out if off
+	XContentTypeOptions string `query:"x_content_type_options"`
+	// Referrer-Policy, left out if off
+	ReferrerPolicy string `query:"referrer_policy"`
+	// Permissions-Policy, left out if off
+	PermissionsPolicy string `query:"permissions_policy"`
+	// Cross-Origin-Opener-Policy, left out if off
+	COOP string `query:"coop"`
+	// Cross-Origin-Embedder-Policy, left out if off
+	COEP string `query:"coep"`
+	// Cross-Origin-Resource-Policy, left out if off
+	CORP string `query:"corp"`
+}
+
+// securityHeader is a header of /security-headers, with its strict and
+// malformed values.
+type securityHeader struct {
+	param     string
+	name      string
+	value     *string
+	strict    string
+	malformed string
+}
+
+// securityHeaders lists the headers of p, whose CSP reports go to reportURI.
+func (p *securityHeadersParams) securityHeaders(reportURI string) []securityHeader {
+	csp := "default-src 'self'; object-src 'none'; base-uri 'none'; frame-ancestors 'none'; report-uri " + reportURI + "; report-to " + cspReportEndpoint
+	return []securityHeader{
+		// directives not separated by semicolons
+		{"csp", "Content-Security-Policy", &p.CSP, csp, "default-src 'self' script-src 'unsafe-inline' 'self"},
+		{"csp_report_only", "Content-Security-Policy-Report-Only", &p.CSPReportOnly, csp, "default-src: self; report-uri"},
+		// endpoints are quoted strings
+		{"reporting_endpoints", "Reporting-Endpoints", &p.ReportingEndpoints, fmt.Sprintf("%s=%q", cspReportEndpoint, reportURI), cspReportEndpoint + "=" + reportURI},
+		{"hsts", "Strict-Transport-Security", &p.HSTS, "max-age=63072000; includeSubDomains; preload", "max-age=-1; includeSubDomains; includeSubDomains"},
+		{"x_frame_options", "X-Frame-Options", &p.XFrameOptions, "DENY", "SAMEORIGIN, DENY"},
+		{"x_content_type_options", "X-Content-Type-Options", &p.XContentTypeOptions, "nosniff", "no-sniff"},
+		{"referrer_policy", "Referrer-Policy", &p.ReferrerPolicy, "no-referrer", "no-referer"},
+		// Feature-Policy syntax
+		{"permissions_policy", "Permissions-Policy", &p.PermissionsPolicy, "camera=(), microphone=(), geolocation=()", "camera 'none'; microphone 'none'"},
+		{"coop", "Cross-Origin-Opener-Policy", &p.COOP, "same-origin", "same-origin-allow-popup"},
+		{"coep", "Cross-Origin-Embedder-Policy", &p.COEP, "require-corp", "require_corp"},
+		{"corp", "Cross-Origin-Resource-Policy", &p.CORP, "same-origin", "same_site"},
+	}
+}
+
+// @Summary  Returns strict, custom or malformed security headers, to test how they are linted or enforced. Violations of the strict CSP are reported to /csp-report.
+// @Tags     Response inspection
+// @Produce  json
+// @Param    preset                  query     string    false  "Values of headers not given, strict ones or none"   default(strict)                                                                                                                                         Enums(strict, none)
+// @Param    malformed               query     []string  false  "Headers to send malformed values of, unless given"  Enums(csp, csp_report_only, reporting_endpoints, hsts, x_frame_options, x_content_type_options, referrer_policy, permissions_policy, coop, coep, corp)  collectionFormat(multi)
+// @Param    csp                     query     string    false  "Content-Security-Policy, left out if off"
+// @Param    csp_report_only         query     string    false  "Content-Security-Policy-Report-Only, left out if off"
+// @Param    reporting_endpoints     query     string    false  "Reporting-Endpoints, left out if off"
+// @Param    hsts                    query     string    false  "Strict-Transport-Security, left out if off"
+// @Param    x_frame_options         query     string    false  "X-Frame-Options, left out if off"
+// @Param    x_content_type_options  query     string    false  "X-Content-Type-Options, left out if off"
+// @Param    referrer_policy         query     string    false  "Referrer-Policy, left out if off"
+// @Param    permissions_policy      query     string    false  "Permissions-Policy, left out if off"
+// @Param    coop                    query     string    false  "Cross-Origin-Opener-Policy, left out if off"
+// @Param    coep                    query     string    false  "Cross-Origin-Embedder-Policy, left out if off"
+// @Param    corp                    query     string    false  "Cross-Origin-Resource-Policy, left out if off"
+// @Success  200                     {object}  securityHeadersResponse
+// @Router   /security-headers [get]
+func securityHeadersHandler(c echo.Context) error {
+	p := &securityHeadersParams{Preset: "strict"}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if p.Preset != "strict" && p.Preset != "none" {
+		return echo.NewHTTPError(http.StatusBadRequest, "preset must be strict or none")
+	}
+	reportURI := c.Scheme() + "://" + c.Request().Host + c.Echo().URI(cspReportHandler)
+	headers := p.securityHeaders(reportURI)
+	malformed := map[string]bool{}
+	for _, v := range p.Malformed {
+		found := false
+		for _, h := range headers {
+			found = found || h.param == v
+		}
+		if !found {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown header %q to malform", v))
+		}
+		malformed[v] = true
+	}
+
+	res := &securityHeadersResponse{Headers: map[string]string{}}
+	for _, h := range headers {
+		value := *h.value
+		switch {
+		case value == "off":
+			continue
+		case value != "":
+		case malformed[h.param]:
+			value = h.malformed
+		case p.Preset == "strict":
+			value = h.strict
+		default:
+			continue
+		}
+		c.Response().Header().Set(h.name, value)
+		res.Headers[h.name] = value
+	}
+	return c.JSONPretty(http.StatusOK, res, "  ")
+}
+
+// cspReportLog keeps the latest reports received by /csp-report.
+type cspReportLog struct {
+	mu      sync.Mutex
+	reports []cspReport
+}
+
+var cspReports = &cspReportLog{}
+
+func (l *cspReportLog) add(reports ...cspReport) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reports = append(l.reports, reports...)
+	if n := len(l.reports) - conf.Limits.MaxCSPReports; n > 0 {
+		l.reports = append(l.reports[:0], l.reports[n:]...)
+	}
+}
+
+func (l *cspReportLog) list() []cspReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]cspReport{}, l.reports...)
+}
+
+func (l *cspReportLog) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reports = nil
+}
+
+// parseCSPReports parses the reports of a report-uri or Reporting API
+// request body.
+func parseCSPReports(contentType string, body []byte, userAgent string) ([]cspReport, error) {
+	now := time.Now().UTC()
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == mimeReportsJSON || (len(body) > 0 && body[0] == '[') {
+		var payloads []struct {
+			Type      string                 `json:"type"`
+			URL       string                 `json:"url"`
+			UserAgent string                 `json:"user_agent"`
+			Body      map[string]interface{} `json:"body"`
+		}
+		if err := json.Unmarshal(body, &payloads); err != nil {
+			return nil, err
+		}
+		reports := make([]cspReport, 0, len(payloads))
+		for _, v := range payloads {
+			reports = append(reports, cspReport{
+				Received:  now,
+				Format:    "reporting-api",
+				Type:      v.Type,
+				URL:       v.URL,
+				UserAgent: v.UserAgent,
+				Body:      v.Body,
+			})
+		}
+		return reports, nil
+	}
+	var payload struct {
+		Report map[string]interface{} `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Report == nil {
+		return nil, fmt.Errorf("no csp-report")
+	}
+	url, _ := payload.Report["document-uri"].(string)
+	return []cspReport{{
+		Received:  now,
+		Format:    "report-uri",
+		Type:      "csp-violation",
+		URL:       url,
+		UserAgent: userAgent,
+		Body:      payload.Report,
+	}}, nil
+}
+
+// @Summary   Collects CSP violation reports, sent to report-uri as application/csp-report or by the Reporting API as application/reports+json.
+// @Tags      Response inspection
+// @Accept    json
+// @Param     report  body  object  true  "The reports"
+// @Response  204     "The reports were collected"
+// @Router    /csp-report [post]
+func cspReportHandler(c echo.Context) error {
+	req := c.Request()
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxCSPReportBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxCSPReportBytes {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("reports must not be larger than %d bytes", maxCSPReportBytes))
+	}
+	reports, err := parseCSPReports(req.Header.Get(echo.HeaderContentType), body, req.UserAgent())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid reports: "+err.Error())
+	}
+	cspReports.add(reports...)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// @Summary  Lists the latest reports collected by /csp-report, oldest first.
+// @Tags     Response inspection
+// @Produce  json
+// @Success  200  {array}  cspReport
+// @Router   /csp-report [get]
+func cspReportsHandler(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSONPretty(http.StatusOK, cspReports.list(), "  ")
+}
+
+// @Summary   Forgets the reports collected by /csp-report.
+// @Tags      Response inspection
+// @Response  204  "The reports were deleted"
+// @Router    /csp-report [delete]
+func deleteCSPReportsHandler(c echo.Context) error {
+	cspReports.clear()
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityHeadersHandler(t *testing.T) {
+	e := newEcho()
+	serve := func(target string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, httptest.NewRequest(http.MethodGet, target, nil))
+		return res
+	}
+
+	res := serve("/security-headers")
+	assert.Equal(t, http.StatusOK, res.Code)
+	h := res.Header()
+	assert.Equal(t, "max-age=63072000; includeSubDomains; preload", h.Get("Strict-Transport-Security"))
+	assert.Equal(t, "DENY", h.Get("X-Frame-Options"))
+	assert.Equal(t, `csp-endpoint="http://example.com/csp-report"`, h.Get("Reporting-Endpoints"))
+	assert.Contains(t, h.Get("Content-Security-Policy"), "report-uri http://example.com/csp-report; report-to csp-endpoint")
+	shr := securityHeadersResponse{}
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &shr)) {
+		assert.Len(t, shr.Headers, 11)
+		assert.Equal(t, "require-corp", shr.Headers["Cross-Origin-Embedder-Policy"])
+	}
+
+	res = serve("/security-headers?preset=none&malformed=hsts&malformed=coop&referrer_policy=origin")
+	h = res.Header()
+	assert.Equal(t, "max-age=-1; includeSubDomains; includeSubDomains", h.Get("Strict-Transport-Security"))
+	assert.Equal(t, "same-origin-allow-popup", h.Get("Cross-Origin-Opener-Policy"))
+	assert.Equal(t, "origin", h.Get("Referrer-Policy"))
+	assert.Empty(t, h.Get("Content-Security-Policy"))
+
+	res = serve("/security-headers?hsts=off&malformed=x_frame_options")
+	assert.Empty(t, res.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "SAMEORIGIN, DENY", res.Header().Get("X-Frame-Options"))
+
+	assert.Equal(t, http.StatusBadRequest, serve("/security-headers?preset=lax").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/security-headers?malformed=x_xss_protection").Code)
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Limits.MaxCSPReports = 2
+	e := newEcho()
+	serve := func(method, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/csp-report", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		req.Header.Set("User-Agent", "test")
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		return res
+	}
+	list := func() []cspReport {
+		reports := []cspReport{}
+		res := serve(http.MethodGet, "", "")
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &reports))
+		return reports
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "", "").Code)
+	assert.Empty(t, list())
+	res := serve(http.MethodPost, mimeCSPReport, `{"csp-report": {"document-uri": "https://example.com/", "violated-directive": "script-src"}}`)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	reports := list()
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, "report-uri", reports[0].Format)
+		assert.Equal(t, "https://example.com/", reports[0].URL)
+		assert.Equal(t, "test", reports[0].UserAgent)
+		assert.Equal(t, "script-src", reports[0].Body["violated-directive"])
+	}
+
+	res = serve(http.MethodPost, mimeReportsJSON, `[
+		{"type": "csp-violation", "url": "https://example.com/a", "user_agent": "browser", "body": {"effectiveDirective": "img-src"}},
+		{"type": "csp-violation", "url": "https://example.com/b", "user_agent": "browser", "body": {"effectiveDirective": "font-src"}}
+	]`)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	reports = list()
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, "reporting-api", reports[0].Format)
+		assert.Equal(t, "https://example.com/a", reports[0].URL)
+		assert.Equal(t, "browser", reports[1].UserAgent)
+		assert.Equal(t, "font-src", reports[1].Body["effectiveDirective"])
+	}
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, mimeCSPReport, `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, mimeReportsJSON, `[`).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(http.MethodPost, mimeCSPReport, strings.Repeat(" ", maxCSPReportBytes+1)).Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "", "").Code)
+	assert.Empty(t, list())
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const sessionCookieName = "echobin_session"
+
+// maxSessionCookieBytes is the size of cookies browsers are required to keep.
+const maxSessionCookieBytes = 4096
+
+// Session cookies are "s.<payload>.<signature>" when signed, and
+// "e.<nonce and ciphertext>" when encrypted, all base64url encoded.
+const (
+	sessionModeSigned    = "signed"
+	sessionModeEncrypted = "encrypted"
+)
+
+var (
+	errNoSession               = errors.New("no session cookie")
+	errMalformedSession        = errors.New("malformed session cookie")
+	errInvalidSessionSignature = errors.New("invalid signature")
+	errSessionDecryption       = errors.New("decryption failed, the cookie was tampered with or encrypted with another secret")
+	errSessionExpired          = errors.New("session expired")
+)
+
+// randomSessionSecret is used when no secret is configured, so sessions are
+// lost on restarts.
+var randomSessionSecret = func() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}()
+
+// sessionKey derives the key of given purpose from the configured secret.
+func sessionKey(purpose string) []byte {
+	secret := []byte(conf.Session.Secret)
+	if len(secret) == 0 {
+		secret = randomSessionSecret
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+type session struct {
+	ID      string            `json:"id"`
+	Mode    string            `json:"mode"`
+	Created time.Time         `json:"created"`
+	Expires time.Time         `json:"expires"`
+	Values  map[string]string `json:"values"`
+}
+
+func newSession(mode string, ttl time.Duration) *session {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &session{
+		ID:      uuid.NewString(),
+		Mode:    mode,
+		Created: now,
+		Expires: now.Add(ttl),
+		Values:  map[string]string{},
+	}
+}
+
+func sessionSignature(payload string) string {
+	mac := hmac.New(sha256.New, sessionKey("sign"))
+	mac.Write([]byte("s." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func sessionCipher() cipher.AEAD {
+	block, _ := aes.NewCipher(sessionKey("encrypt"))
+	gcm, _ := cipher.NewGCM(block)
+	return gcm
+}
+
+// encode returns the cookie value of the session.
+func (s *session) encode() (string, error) {
+	payload, _ := json.Marshal(s)
+	if s.Mode == sessionModeEncrypted {
+		gcm := sessionCipher()
+		nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(payload)+gcm.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		return "e." + base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, payload, []byte("e."))), nil
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return "s." + encoded + "." + sessionSignature(encoded), nil
+}
+
+// decodeSession verifies and decodes a session cookie value. Expired sessions
+// are returned along with errSessionExpired.
+func decodeSession(value string) (*session, error) {
+	var payload []byte
+	parts := strings.Split(value, ".")
+	switch {
+	case len(parts) == 3 && parts[0] == "s":
+		if !hmac.Equal([]byte(parts[2]), []byte(sessionSignature(parts[1]))) {
+			return nil, errInvalidSessionSignature
+		}
+		var err error
+		if payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+			return nil, errMalformedSession
+		}
+	case len(parts) == 2 && parts[0] == "e":
+		sealed, err := base64.RawURLEncoding.DecodeString(parts[1])
+		gcm := sessionCipher()
+		if err != nil || len(sealed) < gcm.NonceSize() {
+			return nil, errMalformedSession
+		}
+		nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+		if payload, err = gcm.Open(nil, nonce, ciphertext, []byte("e.")); err != nil {
+			return nil, errSessionDecryption
+		}
+	default:
+		return nil, errMalformedSession
+	}
+	s := &session{}
+	if err := json.Unmarshal(payload, s); err != nil || s.Values == nil {
+		return nil, errMalformedSession
+	}
+	if !time.Now().Before(s.Expires) {
+		return s, errSessionExpired
+	}
+	return s, nil
+}
+
+// getSession returns the session of the request.
+func getSession(c echo.Context) (*session, error) {
+	cookie, err := c.Cookie(sessionCookieName)
+	if err != nil {
+		return nil, errNoSession
+	}
+	return decodeSession(cookie.Value)
+}
+
+// sessionCookiePath scopes the session cookie to the routes of echobin.
+func sessionCookiePath() string {
+	if conf.Routes.BasePath == "" {
+		return "/"
+	}
+	return conf.Routes.BasePath
+}
+
+func setSessionCookie(c echo.Context, value string) error {
+	if len(sessionCookieName)+1+len(value) > maxSessionCookieBytes {
+		return echo.NewHTTPError(http.StatusBadRequest, "session would not fit into a cookie")
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookieName,
+		Value:    value,
+		Path:     sessionCookiePath(),
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// saveSession sets the cookie of the session.
+func saveSession(c echo.Context, s *session) error {
+	value, err := s.encode()
+	if err != nil {
+		return err
+	}
+	return setSessionCookie(c, value)
+}
+
+// sessionErrorResponse describes why the session of the request is invalid.
+func sessionErrorResponse(c echo.Context, err error) error {
+	return c.JSONPretty(http.StatusUnauthorized, &sessionResponse{
+		Valid: false,
+		Error: err.Error(),
+	}, "  ")
+}
+
+// redirectToSession redirects to the session, like the cookie handlers
+// redirect to the cookie list.
+func redirectToSession(c echo.Context) error {
+	return c.Redirect(http.StatusFound, c.Echo().URI(getSessionHandler))
+}
+
+// @Summary  Returns the session of the request, or why it is invalid.
+// @Tags     Cookies
+// @Produce  json
+// @Success  200  {object}  sessionResponse
+// @Failure  401  {object}  sessionResponse  "No session, or an expired, malformed or tampered one."
+// @Router   /session [get]
+func getSessionHandler(c echo.Context) error {
+	s, err := getSession(c)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	return c.JSONPretty(http.StatusOK, &sessionResponse{
+		Valid:   true,
+		Session: s,
+	}, "  ")
+}
+
+type newSessionParams struct {
+	// Whether the cookie is signed, or encrypted as well
+	Mode string `query:"mode" enums:"signed,encrypted" default:"signed"`
+	// Lifetime of the session in seconds
+	TTL int `query:"ttl" default:"3600"`
+}
+
+// @Summary   Starts a new session, replacing any current one, and redirects to the session.
+// @Tags      Cookies
+// @Param     newSessionParams  query  newSessionParams  false  "newSessionParams"
+// @Response  302               "Redirect to the session"
+// @Router    /session/new [get]
+func newSessionHandler(c echo.Context) error {
+	p := &newSessionParams{
+		Mode: sessionModeSigned,
+		TTL:  3600,
+	}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if p.Mode != sessionModeSigned && p.Mode != sessionModeEncrypted {
+		return echo.NewHTTPError(http.StatusBadRequest, "mode must be signed or encrypted")
+	}
+	if p.TTL <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "ttl must be positive")
+	}
+	if err := saveSession(c, newSession(p.Mode, time.Duration(p.TTL)*time.Second)); err != nil {
+		return err
+	}
+	return redirectToSession(c)
+}
+
+// @Summary   Sets session values as provided by the query string and redirects to the session. A signed session is started if there is none.
+// @Tags      Cookies
+// @Param     freeform  query  string  false  "freeform"
+// @Response  302       "Redirect to the session"
+// @Failure   401       {object}  sessionResponse  "The session is invalid."
+// @Router    /session/set [get]
+func setSessionHandler(c echo.Context) error {
+	s, err := getSession(c)
+	if err == errNoSession {
+		s, err = newSession(sessionModeSigned, time.Hour), nil
+	}
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	for k, v := range c.QueryParams() {
+		s.Values[k] = v[0]
+	}
+	if err := saveSession(c, s); err != nil {
+		return err
+	}
+	return redirectToSession(c)
+}
+
+// @Summary   Deletes session values as provided by the query string and redirects to the session.
+// @Tags      Cookies
+// @Param     freeform  query  string  false  "freeform"
+// @Response  302       "Redirect to the session"
+// @Failure   401       {object}  sessionResponse  "No session, or an invalid one."
+// @Router    /session/delete [get]
+func deleteSessionHandler(c echo.Context) error {
+	s, err := getSession(c)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	for k := range c.QueryParams() {
+		delete(s.Values, k)
+	}
+	if err := saveSession(c, s); err != nil {
+		return err
+	}
+	return redirectToSession(c)
+}
+
+// @Summary   Gives the session a new ID, keeping its values, and redirects to the session.
+// @Tags      Cookies
+// @Response  302  "Redirect to the session"
+// @Failure   401  {object}  sessionResponse  "No session, or an invalid one."
+// @Router    /session/rotate [get]
+func rotateSessionHandler(c echo.Context) error {
+	s, err := getSession(c)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	s.ID = uuid.NewString()
+	if err := saveSession(c, s); err != nil {
+		return err
+	}
+	return redirectToSession(c)
+}
+
+type expireSessionParams struct {
+	// Seconds until the session expires, the cookie is deleted right away if 0
+	In int `query:"in"`
+}
+
+// @Summary   Expires the session and redirects to the session. The cookie is kept when the session expires later, to see expired sessions being rejected.
+// @Tags      Cookies
+// @Param     expireSessionParams  query  expireSessionParams  false  "expireSessionParams"
+// @Response  302                  "Redirect to the session"
+// @Failure   401                  {object}  sessionResponse  "No session, or an invalid one."
+// @Router    /session/expire [get]
+func expireSessionHandler(c echo.Context) error {
+	p := &expireSessionParams{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, p); err != nil {
+		return err
+	}
+	if p.In < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "in must not be negative")
+	}
+	if p.In == 0 {
+		c.SetCookie(&http.Cookie{
+			Name:   sessionCookieName,
+			Path:   sessionCookiePath(),
+			MaxAge: -1,
+		})
+		return redirectToSession(c)
+	}
+	s, err := getSession(c)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	s.Expires = time.Now().UTC().Add(time.Duration(p.In) * time.Second)
+	if err := saveSession(c, s); err != nil {
+		return err
+	}
+	return redirectToSession(c)
+}
+
+// @Summary   Modifies the session cookie without signing it again, and redirects to the session, which should then be rejected.
+// @Tags      Cookies
+// @Response  302  "Redirect to the session"
+// @Failure   401  {object}  sessionResponse  "No session, or an invalid one."
+// @Router    /session/tamper [get]
+func tamperSessionHandler(c echo.Context) error {
+	s, err := getSession(c)
+	if err != nil {
+		return sessionErrorResponse(c, err)
+	}
+	value, err := s.encode()
+	if err != nil {
+		return err
+	}
+	if s.Mode == sessionModeEncrypted {
+		// flip a bit of the ciphertext
+		sealed, _ := base64.RawURLEncoding.DecodeString(value[2:])
+		sealed[len(sealed)-1] ^= 1
+		value = "e." + base64.RawURLEncoding.EncodeToString(sealed)
+	} else {
+		// escalate privileges, keeping the signature. The ID changes too,
+		// so that the payload differs even if the session is an admin one.
+		parts := strings.Split(value, ".")
+		s.Values["admin"] = "true"
+		s.ID = uuid.NewString()
+		payload, _ := json.Marshal(s)
+		value = "s." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+	}
+	if err := setSessionCookie(c, value); err != nil {
+		return err
+	}
+	return redirectToSession(c)
+}
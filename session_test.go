@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionHandlers(t *testing.T) {
+	e := newEcho()
+	// do requests target with the session cookie, updating it like a browser
+	cookie := ""
+	do := func(target string) (*httptest.ResponseRecorder, sessionResponse) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: cookie})
+		}
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		for _, c := range res.Result().Cookies() {
+			if c.Name == sessionCookieName {
+				cookie = c.Value
+				if c.MaxAge < 0 {
+					cookie = ""
+				}
+			}
+		}
+		sr := sessionResponse{}
+		json.Unmarshal(res.Body.Bytes(), &sr)
+		return res, sr
+	}
+
+	res, sr := do("/session")
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, errNoSession.Error(), sr.Error)
+
+	for _, mode := range []string{sessionModeSigned, sessionModeEncrypted} {
+		res, _ = do("/session/new?mode=" + mode)
+		assert.Equal(t, http.StatusFound, res.Code)
+		assert.Equal(t, "/session", res.Header().Get("Location"))
+		assert.Contains(t, res.Header().Get("Set-Cookie"), "; HttpOnly; SameSite=Lax")
+
+		do("/session/set?user=alice&role=viewer")
+		res, sr = do("/session")
+		assert.Equal(t, http.StatusOK, res.Code)
+		if assert.True(t, sr.Valid) {
+			assert.Equal(t, mode, sr.Session.Mode)
+			assert.Equal(t, map[string]string{"user": "alice", "role": "viewer"}, sr.Session.Values)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), sr.Session.Expires, 2*time.Second)
+		}
+		if mode == sessionModeEncrypted {
+			assert.NotContains(t, cookie, "alice")
+		}
+
+		do("/session/delete?role")
+		id := sr.Session.ID
+		do("/session/rotate")
+		_, sr = do("/session")
+		assert.NotEqual(t, id, sr.Session.ID)
+		assert.Equal(t, map[string]string{"user": "alice"}, sr.Session.Values)
+		do("/session/expire?in=60")
+		_, sr = do("/session")
+		assert.WithinDuration(t, time.Now().Add(time.Minute), sr.Session.Expires, 2*time.Second)
+
+		// tampering changes admin sessions too
+		do("/session/set?admin=true")
+		valid := cookie
+		res, _ = do("/session/tamper")
+		assert.Equal(t, http.StatusFound, res.Code)
+		res, sr = do("/session")
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.False(t, sr.Valid)
+		if mode == sessionModeSigned {
+			assert.Equal(t, errInvalidSessionSignature.Error(), sr.Error)
+		} else {
+			assert.Equal(t, errSessionDecryption.Error(), sr.Error)
+		}
+		// tampered sessions can't be changed
+		res, _ = do("/session/set?admin=true")
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		cookie = valid
+		do("/session/expire")
+		assert.Empty(t, cookie)
+		res, sr = do("/session")
+		assert.Equal(t, errNoSession.Error(), sr.Error)
+	}
+
+	for _, target := range []string{"/session/new?mode=plain", "/session/new?ttl=0", "/session/expire?in=-1"} {
+		res, _ = do(target)
+		assert.Equal(t, http.StatusBadRequest, res.Code, target)
+	}
+}
+
+func TestSessionCookiePath(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	for basePath, path := range map[string]string{"": "/", "/echobin": "/echobin"} {
+		conf.Routes.BasePath = basePath
+		e := newEcho()
+		for _, target := range []string{"/session/new", "/session/expire"} {
+			req := httptest.NewRequest(http.MethodGet, basePath+target, nil)
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+			if cookies := res.Result().Cookies(); assert.Len(t, cookies, 1, target) {
+				assert.Equal(t, path, cookies[0].Path, target)
+			}
+		}
+	}
+}
+
+func TestDecodeSession(t *testing.T) {
+	defer func(c *config) { conf = c }(conf)
+	conf = defaultConfig()
+	conf.Session.Secret = "secret"
+
+	encode := func(s *session) string {
+		value, err := s.encode()
+		assert.NoError(t, err)
+		return value
+	}
+	s := newSession(sessionModeSigned, time.Hour)
+	s.Values["a"] = "b"
+	decoded, err := decodeSession(encode(s))
+	if assert.NoError(t, err) {
+		assert.Equal(t, s, decoded)
+	}
+
+	expired := newSession(sessionModeEncrypted, -time.Second)
+	decoded, err = decodeSession(encode(expired))
+	assert.Equal(t, errSessionExpired, err)
+	assert.Equal(t, expired.ID, decoded.ID)
+
+	// another secret
+	signed, encrypted := encode(s), encode(expired)
+	conf.Session.Secret = "another"
+	_, err = decodeSession(signed)
+	assert.Equal(t, errInvalidSessionSignature, err)
+	_, err = decodeSession(encrypted)
+	assert.Equal(t, errSessionDecryption, err)
+
+	for _, v := range []string{"", "s.e30", "x.e30.e30", "e.!!", "e.e30", "s.e30." + sessionSignature("e30")} {
+		_, err = decodeSession(v)
+		assert.Equal(t, errMalformedSession, err, v)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// streamAbort is closed on shutdown when shutdown.abort_streams is set,
+// telling streaming handlers to give up instead of finishing their bodies.
+var streamAbort = make(chan struct{})
+
+// pause sleeps for d in the middle of a response. It returns early with an
+// error if the client has gone away, and aborts the response when streams are
+// aborted on shutdown. A zero d only checks for both conditions.
+func pause(c echo.Context, d time.Duration) error {
+	done := c.Request().Context().Done()
+	if d <= 0 {
+		select {
+		case <-done:
+			return c.Request().Context().Err()
+		case <-streamAbort:
+			// Closes the connection without finishing the response, so
+			// that clients can tell the body is incomplete.
+			panic(http.ErrAbortHandler)
+		default:
+			return nil
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-done:
+		return c.Request().Context().Err()
+	case <-streamAbort:
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// recoverLogError keeps the logging of middleware.Recover, but lets
+// http.ErrAbortHandler through so that net/http can abort the response.
+func recoverLogError(c echo.Context, err error, stack []byte) error {
+	if err == http.ErrAbortHandler {
+		panic(err)
+	}
+	c.Logger().Errorf("[PANIC RECOVER] %v %s\n", err, stack)
+	return err
+}
+
+// drain gracefully shuts the server down: /readyz starts failing, and after
+// shutdown.drain_delay no new connections are accepted while in-flight
+// requests get shutdown.drain_timeout to complete.
+func drain(e *echo.Echo, cfg shutdownConfig) error {
+	atomic.StoreInt32(&ready, 0)
+	time.Sleep(time.Duration(cfg.DrainDelay) * time.Second)
+	if cfg.AbortStreams {
+		close(streamAbort)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DrainTimeout)*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		e.Close()
+		return err
+	}
+	return nil
+}
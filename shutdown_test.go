@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPause(t *testing.T) {
+	e := newEcho()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	c := e.NewContext(req, httptest.NewRecorder())
+	assert.NoError(t, pause(c, 0))
+	assert.NoError(t, pause(c, time.Millisecond))
+	cancel()
+	assert.Error(t, pause(c, 0))
+	assert.Error(t, pause(c, time.Hour))
+
+	defer func(ch chan struct{}) { streamAbort = ch }(streamAbort)
+	streamAbort = make(chan struct{})
+	close(streamAbort)
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	c = e.NewContext(req, httptest.NewRecorder())
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { pause(c, time.Hour) })
+}
+
+func startTestServer(t *testing.T) (string, func(shutdownConfig) error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	e := newEcho()
+	e.HideBanner, e.HidePort = true, true
+	e.Listener = ln
+	go e.Start("")
+	return "http://" + ln.Addr().String(), func(cfg shutdownConfig) error {
+		return drain(e, cfg)
+	}
+}
+
+func TestDrainFinishesInFlightRequests(t *testing.T) {
+	defer atomic.StoreInt32(&ready, 1)
+	url, shutdown := startTestServer(t)
+
+	done := make(chan *http.Response)
+	go func() {
+		res, err := http.Get(url + "/drip?duration=0.5&numbytes=5&delay=0")
+		assert.NoError(t, err)
+		done <- res
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, shutdown(shutdownConfig{DrainTimeout: 5}))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ready))
+
+	res := <-done
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "*****", string(body))
+
+	_, err = http.Get(url + "/get")
+	assert.Error(t, err)
+}
+
+func TestDrainAbortsStreams(t *testing.T) {
+	defer atomic.StoreInt32(&ready, 1)
+	defer func(ch chan struct{}) { streamAbort = ch }(streamAbort)
+	streamAbort = make(chan struct{})
+	url, shutdown := startTestServer(t)
+
+	res, err := http.Get(url + "/drip?duration=10&numbytes=100&delay=0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, shutdown(shutdownConfig{DrainTimeout: 5, AbortStreams: true}))
+	body, err := io.ReadAll(res.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Less(t, len(body), 100)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// chunkExtensionPattern matches chunk extensions like a=1;b="two";c, without
+// the leading semicolon.
+var chunkExtensionPattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+(=([!#$%&'*+.^_`|~0-9A-Za-z-]+|\"[^\"\\\\\r\n]*\"))?(;[!#$%&'*+.^_`|~0-9A-Za-z-]+(=([!#$%&'*+.^_`|~0-9A-Za-z-]+|\"[^\"\\\\\r\n]*\"))?)*$")
+
+type trailersParams struct {
+	N int `param:"n"`
+	// Bytes per chunk, at most n
+	ChunkSize int `query:"chunk_size" default:"1024"`
+	// Milliseconds to wait between chunks, limited so that the response takes at most 60 seconds
+	ChunkDelay int `query:"chunk_delay" default:"0"`
+	// Extension added to every chunk, e.g. name=value;other="quoted". The response is then written to the connection as is, which needs HTTP/1.1.
+	Extension string `query:"extension"`
+	// Value of the grpc-status trailer
+	GRPCStatus int `query:"grpc_status" default:"0"`
+	// Value of the grpc-message trailer, left out if empty
+	GRPCMessage string `query:"grpc_message"`
+	// Whether the checksum trailers don't match the body
+	BadChecksum bool `query:"bad_checksum"`
+	// Whether trailers are sent without being declared in the Trailer header
+	Undeclared bool `query:"undeclared"`
+}
+
+// chunkedWriter writes the chunks and trailers of a response.
+type chunkedWriter interface {
+	writeChunk(p []byte) error
+	writeTrailers(trailers http.Header) error
+}
+
+// responseChunkedWriter leaves the chunked encoding to net/http.
+type responseChunkedWriter struct {
+	res        *echo.Response
+	undeclared bool
+}
+
+func (w *responseChunkedWriter) writeChunk(p []byte) error {
+	if _, err := w.res.Write(p); err != nil {
+		return err
+	}
+	w.res.Flush()
+	return nil
+}
+
+func (w *responseChunkedWriter) writeTrailers(trailers http.Header) error {
+	for k, v := range trailers {
+		if w.undeclared {
+			k = http.TrailerPrefix + k
+		}
+		w.res.Header()[k] = v
+	}
+	return nil
+}
+
+// rawChunkedWriter writes the chunked encoding to a hijacked connection, with
+// extensions on every chunk.
+type rawChunkedWriter struct {
+	rw        *bufio.ReadWriter
+	extension string
+}
+
+func (w *rawChunkedWriter) writeChunk(p []byte) error {
+	fmt.Fprintf(w.rw, "%x;%s\r\n", len(p), w.extension)
+	w.rw.Write(p)
+	w.rw.WriteString("\r\n")
+	return w.rw.Flush()
+}
+
+func (w *rawChunkedWriter) writeTrailers(trailers http.Header) error {
+	fmt.Fprintf(w.rw, "0;%s\r\n", w.extension)
+	trailers.Write(w.rw)
+	w.rw.WriteString("\r\n")
+	return w.rw.Flush()
+}
+
+// @Summary   Streams n random bytes in chunks, followed by trailers with checksums of the body and gRPC-like status fields.
+// @Tags      Dynamic data
+// @Produce   octet-stream
+// @Param     n             path   int     true   "The amount of bytes"
+// @Param     seed          query  int     false  "seed"
+// @Param     chunk_size    query  int     false  "Bytes per chunk, at most n"                                                                  default(1024)
+// @Param     chunk_delay   query  int     false  "Milliseconds to wait between chunks, limited so that the response takes at most 60 seconds"  default(0)
+// @Param     extension     query  string  false  "Extension added to every chunk, e.g. name=value;other='quoted'. The response is then written to the connection as is, which needs HTTP/1.1."
+// @Param     grpc_status   query  int     false  "Value of the grpc-status trailer"  default(0)
+// @Param     grpc_message  query  string  false  "Value of the grpc-message trailer, left out if empty"
+// @Param     bad_checksum  query  bool    false  "Whether the checksum trailers don't match the body"
+// @Param     undeclared    query  bool    false  "Whether trailers are sent without being declared in the Trailer header"
+// @Response  200           "Bytes, with Content-Digest, X-Checksum-Crc32, X-Echobin-Chunks, grpc-status and grpc-message trailers."
+// @Router    /trailers/{n} [get]
+func trailersHandler(c echo.Context) error {
+	p := &trailersParams{
+		ChunkSize: 1024,
+	}
+	if err := c.Bind(p); err != nil {
+		return err
+	}
+	if p.N < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid number of bytes")
+	} else if p.N > conf.Limits.MaxBytes {
+		p.N = conf.Limits.MaxBytes
+	}
+	// chunks are never larger than the body, which keeps the buffer small
+	if p.ChunkSize > p.N {
+		p.ChunkSize = p.N
+	}
+	if p.ChunkSize < 1 {
+		p.ChunkSize = 1
+	}
+	chunks := (p.N + p.ChunkSize - 1) / p.ChunkSize
+	if p.ChunkDelay < 0 {
+		p.ChunkDelay = 0
+	} else if chunks > 1 && p.ChunkDelay > conf.Limits.MaxDuration*1000/(chunks-1) {
+		p.ChunkDelay = conf.Limits.MaxDuration * 1000 / (chunks - 1)
+	}
+	if p.Extension != "" && !chunkExtensionPattern.MatchString(p.Extension) {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid chunk extension")
+	}
+	r, err := getRand(c)
+	if err != nil {
+		return err
+	}
+
+	names := []string{"Content-Digest", "X-Checksum-Crc32", "X-Echobin-Chunks", "Grpc-Status"}
+	if p.GRPCMessage != "" {
+		names = append(names, "Grpc-Message")
+	}
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	if !p.Undeclared {
+		h.Set("Trailer", strings.Join(names, ", "))
+	}
+
+	var w chunkedWriter = &responseChunkedWriter{res: c.Response(), undeclared: p.Undeclared}
+	if p.Extension != "" {
+		hj, ok := c.Response().Writer.(http.Hijacker)
+		if !ok || c.Request().ProtoMajor != 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "chunk extensions need HTTP/1.1")
+		}
+		conn, rw, err := hj.Hijack()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		h.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		h.Set("Connection", "close")
+		h.Set("Transfer-Encoding", "chunked")
+		rw.WriteString("HTTP/1.1 200 OK\r\n")
+		h.Write(rw)
+		rw.WriteString("\r\n")
+		c.Response().Status = http.StatusOK
+		c.Response().Committed = true
+		w = &rawChunkedWriter{rw: rw, extension: p.Extension}
+	} else {
+		c.Response().WriteHeader(http.StatusOK)
+	}
+
+	digest := sha256.New()
+	checksum := crc32.NewIEEE()
+	buf := make([]byte, p.ChunkSize)
+	for i := 0; i < chunks; i++ {
+		if i > 0 {
+			if err := pause(c, time.Duration(p.ChunkDelay)*time.Millisecond); err != nil {
+				return err
+			}
+		}
+		chunk := buf[:p.ChunkSize]
+		if remain := p.N - i*p.ChunkSize; remain < p.ChunkSize {
+			chunk = buf[:remain]
+		}
+		r.Read(chunk)
+		digest.Write(chunk)
+		checksum.Write(chunk)
+		if err := w.writeChunk(chunk); err != nil {
+			return err
+		}
+	}
+
+	if p.BadChecksum {
+		digest.Write([]byte{0})
+		checksum.Write([]byte{0})
+	}
+	trailers := http.Header{}
+	trailers.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest.Sum(nil))+":")
+	trailers.Set("X-Checksum-Crc32", fmt.Sprintf("%08x", checksum.Sum32()))
+	trailers.Set("X-Echobin-Chunks", strconv.Itoa(chunks))
+	trailers.Set("Grpc-Status", strconv.Itoa(p.GRPCStatus))
+	if p.GRPCMessage != "" {
+		trailers.Set("Grpc-Message", p.GRPCMessage)
+	}
+	return w.writeTrailers(trailers)
+}
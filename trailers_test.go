@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrailersHandler(t *testing.T) {
+	s := httptest.NewServer(newEcho())
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/trailers/2500?chunk_size=1000&grpc_status=13&grpc_message=internal")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+		// declared trailers are known before the body is read
+		assert.Len(t, res.Trailer, 5)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Len(t, body, 2500)
+		sum := sha256.Sum256(body)
+		assert.Equal(t, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":", res.Trailer.Get("Content-Digest"))
+		assert.Equal(t, "3", res.Trailer.Get("X-Echobin-Chunks"))
+		assert.Equal(t, "13", res.Trailer.Get("Grpc-Status"))
+		assert.Equal(t, "internal", res.Trailer.Get("Grpc-Message"))
+	}
+
+	res, err = http.Get(s.URL + "/trailers/10?undeclared=true&bad_checksum=true")
+	if assert.NoError(t, err) {
+		assert.Empty(t, res.Trailer)
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		sum := sha256.Sum256(body)
+		assert.NotEqual(t, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":", res.Trailer.Get("Content-Digest"))
+		assert.Equal(t, "0", res.Trailer.Get("Grpc-Status"))
+		assert.Empty(t, res.Trailer.Get("Grpc-Message"))
+	}
+
+	// chunks are no larger than the body
+	for _, target := range []string{
+		"/trailers/10?chunk_size=1099511627776",
+		"/trailers/10?chunk_size=9223372036854775807",
+	} {
+		res, err := http.Get(s.URL + target)
+		if assert.NoError(t, err) {
+			body, _ := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.Len(t, body, 10, target)
+			assert.Equal(t, "1", res.Trailer.Get("X-Echobin-Chunks"), target)
+		}
+	}
+
+	// chunk extensions are written to the connection as is
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		io.WriteString(conn, "GET /trailers/5?chunk_size=3&extension=a%3D1%3Bb%3D%22two%22 HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		raw, _ := ioutil.ReadAll(bufio.NewReader(conn))
+		assert.Contains(t, string(raw), "\r\nTransfer-Encoding: chunked\r\n")
+		assert.Contains(t, string(raw), "\r\n\r\n3;a=1;b=\"two\"\r\n")
+		assert.Contains(t, string(raw), "\r\n2;a=1;b=\"two\"\r\n")
+		assert.Contains(t, string(raw), "\r\n0;a=1;b=\"two\"\r\nContent-Digest: sha-256=:")
+		assert.True(t, strings.HasSuffix(string(raw), "\r\nX-Echobin-Chunks: 2\r\n\r\n"), string(raw))
+	}
+
+	for _, target := range []string{
+		"/trailers/-1",
+		"/trailers/10?extension=a%0D%0Ab",
+		"/trailers/10?extension=%3Ba",
+	} {
+		res, err := http.Get(s.URL + target)
+		if assert.NoError(t, err) {
+			res.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode, target)
+		}
+	}
+}
+
+func TestAnythingTrailers(t *testing.T) {
+	s := httptest.NewServer(newEcho())
+	defer s.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL+"/anything", ioutil.NopCloser(strings.NewReader("hello")))
+	req.Trailer = http.Header{"X-Checksum": {"abc"}}
+	res, err := http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		ar := anythingResponse{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&ar))
+		res.Body.Close()
+		assert.Equal(t, "hello", ar.Data)
+		assert.Equal(t, map[string]string{"X-Checksum": "abc"}, ar.Trailers)
+	}
+}